@@ -4,10 +4,8 @@ go 1.25
 
 require (
 	github.com/sirupsen/logrus v1.9.3
+	go.etcd.io/bbolt v1.4.3
 	golang.org/x/sync v0.18.0
 )
 
-require (
-	golang.org/x/sys v0.23.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
-)
+require golang.org/x/sys v0.29.0 // indirect
@@ -10,25 +10,33 @@ import (
 	"io/fs"
 	"net/http"
 	"os"
-	"path"
-	"path/filepath"
-	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-const aniListEndpoint = "https://graphql.anilist.co/"
+const (
+	aniListEndpoint = "https://graphql.anilist.co/"
+	// We rate limit our calls to once every ten seconds, way more than AniList's
+	// stated rate limit of 30 requests per minute.
+	aniListInterval = 10 * time.Second
+)
 const aniListQuery = `
 	query ($search: String!) {
-		Page {
+		Page(perPage: 10) {
 			media(search: $search, type: ANIME) {
 				id
+				idMal
+				episodes
 				title {
 					romaji
 					english
 					native
 				}
+				synonyms
 				coverImage {
 					medium
 				}
@@ -41,11 +49,14 @@ const aniListLookup = `
 		Page {
 			media(id: $id, type: ANIME) {
 				id
+				idMal
+				episodes
 				title {
 					romaji
 					english
 					native
 				}
+				synonyms
 				coverImage {
 					medium
 				}
@@ -60,58 +71,97 @@ type aniListRequest struct {
 }
 
 type aniListResponseMedia struct {
-	Id    int `json:"id"`
-	Title struct {
+	Id       int `json:"id"`
+	IdMal    int `json:"idMal"`
+	Episodes int `json:"episodes"`
+	Title    struct {
 		Romaji  string `json:"romaji"`
 		English string `json:"english"`
 		Native  string `json:"native"`
 	} `json:"title"`
+	Synonyms   []string `json:"synonyms"`
 	CoverImage struct {
 		Medium string `json:"medium"`
 	} `json:"coverImage"`
 }
 type aniListResponse struct {
-	Data struct {
-		Page struct {
-			Media []aniListResponseMedia `json:"media"`
-		}
-	} `json:"data"`
+	Page struct {
+		Media []aniListResponseMedia `json:"media"`
+	}
 }
 
-type titleTransform struct {
-	match     func(string) bool
-	transform func(base, parent string) string
+// queryAniList sends a single GraphQL request to AniList, decoding the data in
+// the response into output.  If an access token is configured, the request is
+// made on behalf of that user.
+func (i *Injester) queryAniList(ctx context.Context, input aniListRequest, output any) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(input); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.aniListEndpoint, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if i.aniListToken != "" {
+		req.Header.Set("Authorization", "Bearer "+i.aniListToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var body bytes.Buffer
+		if resp.Body != nil {
+			_, _ = io.Copy(&body, resp.Body)
+		}
+		return fmt.Errorf("Invalid HTTP status %d: %s", resp.StatusCode, body.String())
+	}
+	if resp.Body == nil {
+		return fmt.Errorf("Failed to get response body")
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("AniList returned error: %s", result.Errors[0].Message)
+	}
+	return json.Unmarshal(result.Data, output)
 }
 
-var titleTransforms = []titleTransform{
-	{
-		match: regexp.MustCompile(`^(?i)\s*season\s*\d+\s*$`).MatchString,
-		transform: func(base, parent string) string {
-			return parent + " " + regexp.MustCompile(`^(?i)\s*season\s*0*`).ReplaceAllString(base, "")
-		},
-	},
-	{
-		match: regexp.MustCompile(`\s+S\d+$`).MatchString,
-		transform: func(base, parent string) string {
-			return regexp.MustCompile(`\s+S(\d+)$`).ReplaceAllString(base, ` $1`)
-		},
-	},
+// copyAniList copies the information looked up from AniList (by requestInfo).
+func (info *InfoType) copyAniList(from *InfoType) {
+	info.AniListID = from.AniListID
+	info.Episodes = from.Episodes
+	info.Titles = from.Titles
+	info.Review = from.Review
+	info.ExternalIDs = from.ExternalIDs
 }
 
 // requestInfo makes a request to AniList and returns the relevant information.
 // This handles rate limiting by artificially extending the function runtime.
 func (i *Injester) requestInfo(ctx context.Context, absPath string, info *InfoType, force, byID bool) error {
 	log := logrus.WithField("directory", absPath)
-	if info.AniListID != 0 && !force {
+	if (info.AniListID != 0 || info.Review != nil) && !force {
 		// We already fetched what we can from AniList, skip.
 		return nil
 	}
-	// We rate limit our calls to once every ten seconds, way more than AniList's
-	// stated rate limit of 30 requests per minute.
-	timeout := time.After(10 * time.Second)
+	timeout := time.After(i.aniListInterval)
 	err := func() error {
 		var input aniListRequest
-		if byID && info.AniListID != 0 {
+		var search string
+		lookup := byID && info.AniListID != 0
+		if lookup {
 			input = aniListRequest{
 				Query: aniListLookup,
 				Variables: map[string]any{
@@ -120,15 +170,7 @@ func (i *Injester) requestInfo(ctx context.Context, absPath string, info *InfoTy
 			}
 			log.WithField("id", info.AniListID).Debug("Requesting info from AniList...")
 		} else {
-			search := path.Base(absPath)
-			for _, transform := range titleTransforms {
-				if transform.match(search) {
-					dir, base := path.Split(absPath)
-					parent := path.Base(dir)
-					search = transform.transform(base, parent)
-					break
-				}
-			}
+			search = i.searchString(absPath)
 			log.WithField("search", search).Debug("Requesting info from AniList...")
 			input = aniListRequest{
 				Query: aniListQuery,
@@ -137,62 +179,94 @@ func (i *Injester) requestInfo(ctx context.Context, absPath string, info *InfoTy
 				},
 			}
 		}
-		var buf bytes.Buffer
-		if err := json.NewEncoder(&buf).Encode(input); err != nil {
-			return err
-		}
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, aniListEndpoint, &buf)
-		if err != nil {
-			return err
-		}
-		req.Header.Set("User-Agent", userAgent)
-		req.Header.Set("Content-Type", "application/json")
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return err
-		}
-		if resp.StatusCode != http.StatusOK {
-			var body bytes.Buffer
-			if resp.Body != nil {
-				_, _ = io.Copy(&body, resp.Body)
-			}
-			return fmt.Errorf("Invalid HTTP status %d: %s", resp.StatusCode, body.String())
-		}
-		if resp.Body == nil {
-			return fmt.Errorf("Failed to get response body")
-		}
-		defer resp.Body.Close()
 		var output aniListResponse
-		if err := json.NewDecoder(resp.Body).Decode(&output); err != nil {
+		if err := i.queryAniList(ctx, input, &output); err != nil {
 			return err
 		}
 		logrus.WithField("response", output).Debug("Got response")
 		info.changed = true // At this point, we either mark it as not found or save the ID
-		if len(output.Data.Page.Media) < 1 {
+		if len(output.Page.Media) < 1 {
 			// No response
 			info.AniListID = -1 // Don't request info about this media again.
 			return nil
 		}
-		media := output.Data.Page.Media[0]
+		media := output.Page.Media[0]
+		if !lookup {
+			var score float64
+			media, score = bestMatch(search, output.Page.Media)
+			if score < matchThreshold {
+				// Don't commit to a match we're unsure about; let the user decide.
+				log.WithField("score", score).Info("Low confidence match needs review")
+				info.Review = &MatchReview{
+					Search: search,
+					ID:     media.Id,
+					Title:  media.Title.Romaji,
+					Score:  score,
+				}
+				return nil
+			}
+		}
+		info.Review = nil
+		sameMedia := info.AniListID == media.Id
 		info.AniListID = media.Id
-		if media.Title.English != "" {
-			info.EnglishTitle = media.Title.English
+		info.Episodes = media.Episodes
+		// Collect the titles separately, so that the Chinese titles found
+		// before can be kept if WikiData fails.
+		found := &InfoType{Titles: make(map[string][]string)}
+		found.AddTitle(LangJapanese, media.Title.Native)
+		found.AddTitle(LangRomaji, media.Title.Romaji)
+		found.AddTitle(LangEnglish, media.Title.English)
+		for _, synonym := range media.Synonyms {
+			found.AddTitle(guessLanguage(synonym), synonym)
 		}
-		if media.Title.Native != "" {
-			info.NativeTitle = media.Title.Native
+		externalIDs := make(map[string]string)
+		if media.IdMal != 0 {
+			externalIDs[IDMyAnimeList] = strconv.Itoa(media.IdMal)
+		}
+
+		titles, ids, err := getChineseTitles(ctx, i.wikiDataEndpoint, media.Id, log)
+		if ids == nil && sameMedia {
+			// WikiData could not be queried; keep what was found before.
+			ids = info.ExternalIDs
 		}
+		for key, value := range ids {
+			if _, ok := externalIDs[key]; !ok {
+				externalIDs[key] = value
+			}
+		}
+		info.ExternalIDs = externalIDs
+		if err != nil {
+			log.WithError(err).Error("failed to get Chinese title")
+			titles = make(map[string]string)
+			if sameMedia {
+				for tag, previous := range info.Titles {
+					if len(previous) > 0 && (tag == LangChinese || strings.HasPrefix(tag, LangChinese+"-")) {
+						titles[tag] = previous[0]
+					}
+				}
+			}
+		}
+		// Prefer the titles from WikiData over guessed synonyms.
+		for tag, title := range titles {
+			synonyms := slices.DeleteFunc(found.Titles[tag], func(s string) bool { return s == title })
+			found.Titles[tag] = append([]string{title}, synonyms...)
+		}
+		info.Titles = found.Titles
+
 		if media.CoverImage.Medium != "" {
-			coverPath := filepath.Join(absPath, ".cover.jpg")
 			needCover := byID && force
 			if !needCover {
-				if f, err := os.Open(coverPath); errors.Is(err, fs.ErrNotExist) {
+				if f, err := os.Open(i.artifacts.Path(CoverPath(absPath))); errors.Is(err, fs.ErrNotExist) {
 					needCover = true
 				} else if err == nil {
 					_ = f.Close()
 				}
 			}
 			if needCover {
+				coverPath, err := i.artifacts.WritePath(CoverPath(absPath))
+				if err != nil {
+					return err
+				}
 				f, err := os.Create(coverPath)
 				if err != nil {
 					return err
@@ -217,13 +291,6 @@ func (i *Injester) requestInfo(ctx context.Context, absPath string, info *InfoTy
 			}
 		}
 
-		result, err := getChineseTitle(ctx, media.Id, log)
-		if err == nil {
-			info.ChineseTitle = result
-		} else {
-			log.WithError(err).Error("failed to get Chinese title")
-		}
-
 		return nil
 	}()
 	log.WithError(err).WithField("info", info).Debug("Requested info from AniList")
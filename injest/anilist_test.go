@@ -0,0 +1,166 @@
+package injest
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// setupRequest creates an injester talking to a fake AniList server that
+// returns the given media, and a fake WikiData server replying with the given
+// status.
+func setupRequest(t *testing.T, media []aniListResponseMedia, wikiDataStatus int) *Injester {
+	fake := &fakeAniList{t: t, token: "secret", media: media}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	i := New(t.TempDir(), Options{AniListToken: fake.token})
+	i.aniListEndpoint = server.URL
+	i.aniListInterval = 0
+	i.wikiDataEndpoint = fakeWikiData(t, wikiDataStatus).URL
+	return i
+}
+
+func TestRequestInfoExternalIDs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		id       int
+		status   int
+		expected map[string]string
+	}{
+		{"found", 16498, http.StatusOK, map[string]string{
+			IDMyAnimeList: "16498", IDBangumi: "55770", IDAniDB: "9541", IDKitsu: "7442",
+		}},
+		{"failed", 16498, http.StatusServiceUnavailable, map[string]string{
+			IDMyAnimeList: "16498", IDBangumi: "1", IDAniDB: "2",
+		}},
+		{"failed for other media", 1, http.StatusServiceUnavailable, map[string]string{
+			IDMyAnimeList: "16498",
+		}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			media := aniListResponseMedia{Id: 16498, IdMal: 16498}
+			media.Title.Romaji = "Shingeki no Kyojin"
+			i := setupRequest(t, []aniListResponseMedia{media}, testCase.status)
+			info := &InfoType{
+				AniListID:   testCase.id,
+				ExternalIDs: map[string]string{IDMyAnimeList: "1", IDBangumi: "1", IDAniDB: "2"},
+			}
+			err := i.requestInfo(context.Background(), filepath.Join(i.root, "show"), info, true, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(info.ExternalIDs, testCase.expected) {
+				t.Errorf("expected IDs %v, got %v", testCase.expected, info.ExternalIDs)
+			}
+		})
+	}
+}
+
+func TestRequestInfoTitles(t *testing.T) {
+	testCases := []struct {
+		name     string
+		id       int
+		status   int
+		expected map[string]string
+	}{
+		{"found", 16498, http.StatusOK, map[string]string{
+			LangEnglish: "Attack on Titan", LangTraditional: "進擊的巨人", LangSimplified: "进击的巨人",
+		}},
+		{"failed", 16498, http.StatusServiceUnavailable, map[string]string{
+			LangEnglish: "Attack on Titan", LangTraditional: "舊標題", LangSimplified: "",
+		}},
+		{"failed for other media", 1, http.StatusServiceUnavailable, map[string]string{
+			LangEnglish: "Attack on Titan", LangTraditional: "", LangSimplified: "",
+		}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			media := aniListResponseMedia{Id: 16498}
+			media.Title.English = "Attack on Titan"
+			i := setupRequest(t, []aniListResponseMedia{media}, testCase.status)
+			info := &InfoType{
+				AniListID: testCase.id,
+				Titles:    map[string][]string{LangEnglish: {"Old"}, LangTraditional: {"舊標題"}},
+			}
+			err := i.requestInfo(context.Background(), filepath.Join(i.root, "show"), info, true, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for lang, expected := range testCase.expected {
+				if titles := info.Titles[lang]; expected == "" && len(titles) > 0 {
+					t.Errorf("expected no %s title, got %v", lang, titles)
+				} else if expected != "" && (len(titles) < 1 || titles[0] != expected) {
+					t.Errorf("expected %s title %q, got %v", lang, expected, titles)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestInfoReview(t *testing.T) {
+	testCases := []struct {
+		name      string
+		directory string
+		confident bool
+	}{
+		{"confident", "Shingeki no Kyojin", true},
+		{"uncertain", "Cowboy Bebop", false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			cover := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte("cover"))
+			}))
+			t.Cleanup(cover.Close)
+			media := aniListResponseMedia{Id: 16498}
+			media.Title.Romaji = "Shingeki no Kyojin"
+			media.CoverImage.Medium = cover.URL
+			i := setupRequest(t, []aniListResponseMedia{media}, http.StatusOK)
+			absPath := filepath.Join(i.root, testCase.directory)
+			if err := os.Mkdir(absPath, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			info := &InfoType{Titles: map[string][]string{LangEnglish: {"Old"}}}
+			if err := i.requestInfo(context.Background(), absPath, info, false, false); err != nil {
+				t.Fatal(err)
+			}
+			_, coverErr := os.Stat(CoverPath(absPath))
+			if testCase.confident {
+				if info.AniListID != media.Id || info.Review != nil {
+					t.Errorf("expected match to be accepted, got ID %d and review %+v", info.AniListID, info.Review)
+				}
+				if info.Title(LangRomaji) != media.Title.Romaji {
+					t.Errorf("expected titles to be updated, got %v", info.Titles)
+				}
+				if coverErr != nil {
+					t.Errorf("expected cover to be saved: %s", coverErr)
+				}
+				return
+			}
+			if info.AniListID != 0 {
+				t.Errorf("expected uncertain match not to set the ID, got %d", info.AniListID)
+			}
+			if info.Review == nil || info.Review.ID != media.Id || info.Review.Search != testCase.directory ||
+				info.Review.Score >= matchThreshold {
+				t.Errorf("unexpected review %+v", info.Review)
+			}
+			if !maps.EqualFunc(info.Titles, map[string][]string{LangEnglish: {"Old"}}, slices.Equal) {
+				t.Errorf("expected titles to be unchanged, got %v", info.Titles)
+			}
+			if !errors.Is(coverErr, fs.ErrNotExist) {
+				t.Errorf("expected no cover for uncertain match, got %v", coverErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package injest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mook/video-listing/thumbnail"
+	"github.com/sirupsen/logrus"
+)
+
+// The name of the cover image artifact of a directory.
+const coverBaseName = ".cover.jpg"
+
+// CacheBaseName is the default name of the directory generated artifacts are
+// stored in, within the state directory.
+const CacheBaseName = ".cache"
+
+// CoverPath returns the sidecar path of the cover image for a directory.
+func CoverPath(directory string) string {
+	return filepath.Join(directory, coverBaseName)
+}
+
+// ThumbnailPath returns the sidecar path of the thumbnail for a video.
+func ThumbnailPath(videoPath string) string {
+	parent, base := filepath.Split(videoPath)
+	return filepath.Join(parent, fmt.Sprintf(".%s.webp", base))
+}
+
+// legacyThumbnailPath returns the sidecar path of thumbnails generated by older
+// versions.
+func legacyThumbnailPath(videoPath string) string {
+	parent, base := filepath.Split(videoPath)
+	return filepath.Join(parent, fmt.Sprintf(".%s.jpg", base))
+}
+
+// Artifacts locates files generated from media, such as thumbnails and covers.
+// Artifacts are identified by their sidecar paths (hidden files next to the
+// media, e.g. from ThumbnailPath); if a cache directory is configured, they are
+// stored there instead, at the same path relative to the media root.  A nil
+// *Artifacts always uses sidecar paths.
+type Artifacts struct {
+	root     string
+	cacheDir string
+}
+
+// NewArtifacts creates an *Artifacts for the given media root; if cacheDir is
+// empty, sidecar files are used.
+func NewArtifacts(root, cacheDir string) (*Artifacts, error) {
+	if cacheDir == "" {
+		return nil, nil
+	}
+	var err error
+	a := &Artifacts{}
+	if a.root, err = filepath.Abs(root); err != nil {
+		return nil, err
+	}
+	if a.cacheDir, err = filepath.Abs(cacheDir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(a.cacheDir, 0o755); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// mirrorPath maps a path under root to the same relative path under target.
+// It returns the empty string if the path is not under root.
+func mirrorPath(root, target, path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(root, absPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return ""
+	}
+	return filepath.Join(target, rel)
+}
+
+// cachePath returns the path of an artifact in the cache directory, or the
+// empty string if it is not cached.
+func (a *Artifacts) cachePath(sidecar string) string {
+	if a == nil {
+		return ""
+	}
+	return mirrorPath(a.root, a.cacheDir, sidecar)
+}
+
+// Path returns the path to read an artifact from.  Artifacts in the cache are
+// preferred, falling back to sidecars generated before the cache directory was
+// configured.
+func (a *Artifacts) Path(sidecar string) string {
+	cached := a.cachePath(sidecar)
+	if cached == "" {
+		return sidecar
+	}
+	if _, err := os.Stat(cached); errors.Is(err, fs.ErrNotExist) {
+		if _, err := os.Stat(sidecar); err == nil {
+			return sidecar
+		}
+	}
+	return cached
+}
+
+// WritePath returns the path to write an artifact to, creating its parent
+// directory as necessary.
+func (a *Artifacts) WritePath(sidecar string) (string, error) {
+	cached := a.cachePath(sidecar)
+	if cached == "" {
+		return sidecar, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cached), 0o755); err != nil {
+		return "", err
+	}
+	return cached, nil
+}
+
+// artifactNames returns the base names of the artifacts that may be generated
+// for a media file with the given base name, other than subtitles.
+func artifactNames(base string) []string {
+	names := []string{
+		ThumbnailPath(base),
+		legacyThumbnailPath(base),
+		PreviewPath(base),
+		TrickplayDir(base),
+	}
+	for _, width := range thumbnail.Widths {
+		names = append(names, thumbnail.SizedPath(ThumbnailPath(base), width))
+	}
+	return names
+}
+
+// isSubtitleArtifact returns whether the given base name is a subtitle
+// conversion (see SubtitlePath) for the media file with the given base name.
+// Track IDs may contain dots, so this can't be an exact match.
+func isSubtitleArtifact(name, base string) bool {
+	prefix, suffix := SubtitlePath(base, ""), ".vtt"
+	prefix = strings.TrimSuffix(prefix, suffix)
+	return len(name) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix)
+}
+
+// Collect removes cached artifacts whose media no longer exists.  Nothing is
+// removed if the media root is empty, as that is more likely to be a missing
+// mount than a library with everything removed.
+func (a *Artifacts) Collect() error {
+	if a == nil {
+		return nil
+	}
+	entries, err := os.ReadDir(a.root)
+	if err != nil {
+		return err
+	}
+	if len(entries) < 1 {
+		logrus.WithField("root", a.root).Warn("Media directory is empty; not removing cached artifacts")
+		return nil
+	}
+	return a.collect(".")
+}
+
+// collectArtifacts is a task to remove stale cached artifacts.
+type collectArtifacts struct {
+	i *Injester
+}
+
+func (c *collectArtifacts) String() string {
+	return "<collect artifacts>"
+}
+
+func (c *collectArtifacts) Process(ctx context.Context) error {
+	return c.i.artifacts.Collect()
+}
+
+// collect removes stale artifacts in a single directory of the cache, relative
+// to the cache root, recursing into subdirectories.
+func (a *Artifacts) collect(relDir string) error {
+	cacheDir := filepath.Join(a.cacheDir, relDir)
+	mediaEntries, err := os.ReadDir(filepath.Join(a.root, relDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		logrus.WithField("directory", relDir).Debug("Removing cache for missing directory")
+		return os.RemoveAll(cacheDir)
+	} else if err != nil {
+		return err
+	}
+	cacheEntries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+	known := map[string]bool{coverBaseName: true}
+	for _, width := range thumbnail.Widths {
+		known[thumbnail.SizedPath(coverBaseName, width)] = true
+	}
+	for _, mediaEntry := range mediaEntries {
+		for _, artifact := range artifactNames(mediaEntry.Name()) {
+			known[artifact] = true
+		}
+	}
+	for _, entry := range cacheEntries {
+		name := entry.Name()
+		if name == infoBaseName {
+			continue // The cache may share a directory with the Store.
+		}
+		if relDir == "." && (name == HistoryBaseName || name == MediaTypesBaseName) {
+			continue // Other state kept in the state directory.
+		}
+		if !strings.HasPrefix(name, ".") {
+			if !entry.IsDir() {
+				continue // Not an artifact, such as a database in the cache.
+			}
+			// A subdirectory of the media.
+			if err := a.collect(filepath.Join(relDir, name)); err != nil {
+				return err
+			}
+			continue
+		}
+		found := known[name]
+		for _, mediaEntry := range mediaEntries {
+			if found {
+				break
+			}
+			found = isSubtitleArtifact(name, mediaEntry.Name())
+		}
+		if !found {
+			logrus.WithField("path", filepath.Join(relDir, name)).Debug("Removing stale artifact")
+			if err := os.RemoveAll(filepath.Join(cacheDir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
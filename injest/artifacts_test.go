@@ -0,0 +1,137 @@
+package injest
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArtifacts(t *testing.T) {
+	root, cacheDir := t.TempDir(), t.TempDir()
+	for _, name := range []string{"show/ep1.mkv", "show/ep2.mkv", "show/.ep2.mkv.webp"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, err := NewArtifacts(root, cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nilArtifacts *Artifacts
+	ep1, ep2 := filepath.Join(root, "show", "ep1.mkv"), filepath.Join(root, "show", "ep2.mkv")
+
+	t.Run("sidecar", func(t *testing.T) {
+		if actual := nilArtifacts.Path(ThumbnailPath(ep1)); actual != ThumbnailPath(ep1) {
+			t.Errorf("unexpected path %s", actual)
+		}
+	})
+	t.Run("cache", func(t *testing.T) {
+		expected := filepath.Join(cacheDir, "show", ".ep1.mkv.webp")
+		if actual := a.Path(ThumbnailPath(ep1)); actual != expected {
+			t.Errorf("expected %s, got %s", expected, actual)
+		}
+		actual, err := a.WritePath(ThumbnailPath(ep1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expected {
+			t.Errorf("expected %s, got %s", expected, actual)
+		}
+		if _, err := os.Stat(filepath.Dir(expected)); err != nil {
+			t.Errorf("parent directory was not created: %v", err)
+		}
+	})
+	t.Run("fallback", func(t *testing.T) {
+		if actual := a.Path(ThumbnailPath(ep2)); actual != ThumbnailPath(ep2) {
+			t.Errorf("expected existing sidecar, got %s", actual)
+		}
+	})
+	t.Run("collect", func(t *testing.T) {
+		keep := []string{
+			filepath.Join(cacheDir, "show", ".ep1.mkv.webp"),
+			filepath.Join(cacheDir, "show", ".ep1.mkv.trickplay", "0.jpg"),
+			filepath.Join(cacheDir, "show", ".ep1.mkv.320.webp"),
+			filepath.Join(cacheDir, "show", ".ep1.mkv.preview.webp"),
+			filepath.Join(cacheDir, "show", ".ep1.mkv.sub.zh.ass.vtt"),
+			filepath.Join(cacheDir, "show", ".cover.jpg"),
+			filepath.Join(cacheDir, "show", ".cover.160.jpg"),
+		}
+		remove := []string{
+			filepath.Join(cacheDir, "show", ".ep3.mkv.webp"),
+			filepath.Join(cacheDir, "show", ".ep3.mkv.trickplay", "0.jpg"),
+			filepath.Join(cacheDir, "show", ".ep3.mkv.sub.e0.vtt"),
+			filepath.Join(cacheDir, "show", ".ep1.mkv.mp4.webp"),
+			filepath.Join(cacheDir, "show", ".ep1.mkv.mp4.trickplay", "0.jpg"),
+			filepath.Join(cacheDir, "gone", ".cover.jpg"),
+		}
+		for _, path := range append(keep, remove...) {
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := a.Collect(); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range keep {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("expected %s to be kept: %v", path, err)
+			}
+		}
+		for _, path := range remove {
+			if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("expected %s to be removed: %v", path, err)
+			}
+		}
+	})
+}
+
+func TestCollectMissingMedia(t *testing.T) {
+	testCases := []struct {
+		name string
+		// Whether the media root exists, but is empty.
+		exists bool
+	}{
+		{"empty", true},
+		{"missing", false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			root, cacheDir := filepath.Join(t.TempDir(), "media"), t.TempDir()
+			if err := os.Mkdir(root, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			a, err := NewArtifacts(root, cacheDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !testCase.exists {
+				if err := os.Remove(root); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cached := filepath.Join(cacheDir, "show", ".ep1.mkv.webp")
+			if err := os.MkdirAll(filepath.Dir(cached), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(cached, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.Collect(); (err == nil) != testCase.exists {
+				t.Errorf("unexpected error %v", err)
+			}
+			if _, err := os.Stat(cached); err != nil {
+				t.Errorf("expected %s to be kept: %v", cached, err)
+			}
+		})
+	}
+}
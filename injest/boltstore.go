@@ -0,0 +1,144 @@
+package injest
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// The name of the bucket containing information about each directory, keyed
+// by the slash separated path relative to the media root.
+var boltInfoBucket = []byte("info")
+
+// BoltStore saves information about all directories in a single embedded
+// database, so that it can be queried without walking the media.
+type BoltStore struct {
+	// The media root directory.
+	root string
+	db   *bolt.DB
+	// Which files are media.
+	media *MediaTypes
+	locks directoryLocks
+}
+
+// NewBoltStore opens (creating if necessary) the database at the given path,
+// for the media at root.  If media is nil, the default media extensions are
+// used.
+func NewBoltStore(root, path string, media *MediaTypes) (*BoltStore, error) {
+	var err error
+	s := &BoltStore{media: media}
+	if s.root, err = filepath.Abs(root); err != nil {
+		return nil, err
+	}
+	if s.db, err = bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second}); err != nil {
+		return nil, err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltInfoBucket)
+		return err
+	})
+	if err != nil {
+		_ = s.db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// key returns the database key for a directory.
+func (s *BoltStore) key(directory string) ([]byte, error) {
+	absPath, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(s.root, absPath)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(filepath.ToSlash(rel)), nil
+}
+
+func (s *BoltStore) ReadInfo(directory string, update bool) (*InfoType, error) {
+	key, err := s.key(directory)
+	if err != nil {
+		return nil, err
+	}
+	info := newInfo()
+	found := false
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltInfoBucket).Get(key)
+		if data == nil {
+			return nil
+		}
+		found = true
+		return decodeInfo(bytes.NewReader(data), info)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refreshInfo(s.root, directory, info, found, update, s.media)
+}
+
+func (s *BoltStore) WriteInfo(directory string, info *InfoType) error {
+	key, err := s.key(directory)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltInfoBucket).Put(key, data)
+	})
+}
+
+func (s *BoltStore) Update(directory string, refresh bool, fn func(info *InfoType) error) error {
+	return s.locks.update(s, directory, refresh, fn)
+}
+
+// Walk visits each directory in the database, without reading the media.
+func (s *BoltStore) Walk(fn func(directory string, info *InfoType) error) error {
+	// Collect everything first, so that fn may write to the store.
+	entries := make(map[string][]byte)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltInfoBucket).ForEach(func(key, data []byte) error {
+			entries[string(key)] = bytes.Clone(data)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for key, data := range entries {
+		info := newInfo()
+		if err := decodeInfo(bytes.NewReader(data), info); err != nil {
+			return err
+		}
+		directory := filepath.Join(s.root, filepath.FromSlash(key))
+		if err := migrateInfo(directory, info); err != nil {
+			return err
+		}
+		if err := fn(directory, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BoltStore) mediaRoot() string {
+	return s.root
+}
+
+// backup copies the whole database, as all directories are in the one file.
+func (s *BoltStore) backup(backupDir string, directories []string) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return copyNewFile(filepath.Join(backupDir, filepath.Base(s.db.Path())), tx)
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
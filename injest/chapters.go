@@ -0,0 +1,73 @@
+package injest
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/mook/video-listing/probe"
+	"github.com/mook/video-listing/thumbnail"
+)
+
+// Sources of intro and outro ranges.
+const (
+	// The range was named by a chapter in the file.
+	RangeSourceChapter = "chapter"
+	// The range was found by comparing the audio with other files.
+	RangeSourceAudio = "audio"
+)
+
+// Range is a section of a media file that players may offer to skip.
+type Range struct {
+	// The start and end of the range, in seconds.
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	// How the range was determined (see the RangeSource* constants).
+	Source string `json:"source"`
+}
+
+var (
+	introChapterRegexp = regexp.MustCompile(`(?i)^\s*(?:op\d*|opening|intro)\b`)
+	outroChapterRegexp = regexp.MustCompile(`(?i)^\s*(?:ed\d*|ending|outro|credits)\b`)
+)
+
+// chapterRanges finds the opening and ending sequences from the names of the
+// chapters of a file; either may be nil if there is no such chapter.
+func chapterRanges(chapters []probe.Chapter) (intro, outro *Range) {
+	for _, chapter := range chapters {
+		if chapter.End <= chapter.Start {
+			continue
+		}
+		r := &Range{Start: chapter.Start, End: chapter.End, Source: RangeSourceChapter}
+		if intro == nil && introChapterRegexp.MatchString(chapter.Title) {
+			intro = r
+		} else if outro == nil && outroChapterRegexp.MatchString(chapter.Title) {
+			outro = r
+		}
+	}
+	return intro, outro
+}
+
+// mergeChapterRange returns the range to use given the existing range and the
+// one from chapters; chapters are preferred, but don't discard ranges found by
+// other means.
+func mergeChapterRange(existing, chapter *Range) *Range {
+	if chapter != nil || existing == nil || existing.Source == RangeSourceChapter {
+		return chapter
+	}
+	return existing
+}
+
+// avoidSpans returns the sections of the file that should not be used for
+// thumbnails and previews.
+func (f *FileInfo) avoidSpans() []thumbnail.Span {
+	var result []thumbnail.Span
+	for _, r := range []*Range{f.Intro, f.Outro} {
+		if r != nil {
+			result = append(result, thumbnail.Span{
+				Start: time.Duration(r.Start * float64(time.Second)),
+				End:   time.Duration(r.End * float64(time.Second)),
+			})
+		}
+	}
+	return result
+}
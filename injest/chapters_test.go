@@ -0,0 +1,64 @@
+package injest
+
+import (
+	"testing"
+
+	"github.com/mook/video-listing/probe"
+)
+
+func TestChapterRanges(t *testing.T) {
+	testCases := []struct {
+		name     string
+		chapters []probe.Chapter
+		intro    *Range
+		outro    *Range
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "named",
+			chapters: []probe.Chapter{
+				{Start: 0, End: 30, Title: "Prologue"},
+				{Start: 30, End: 120, Title: "Opening"},
+				{Start: 120, End: 1300, Title: "Part A"},
+				{Start: 1300, End: 1390, Title: "Ending"},
+				{Start: 1390, End: 1420, Title: "Preview"},
+			},
+			intro: &Range{Start: 30, End: 120, Source: RangeSourceChapter},
+			outro: &Range{Start: 1300, End: 1390, Source: RangeSourceChapter},
+		},
+		{
+			name: "abbreviated",
+			chapters: []probe.Chapter{
+				{Start: 0, End: 90, Title: "OP"},
+				{Start: 90, End: 1300, Title: "Operation"},
+				{Start: 1300, End: 1390, Title: "ED2"},
+			},
+			intro: &Range{Start: 0, End: 90, Source: RangeSourceChapter},
+			outro: &Range{Start: 1300, End: 1390, Source: RangeSourceChapter},
+		},
+		{
+			name: "unnamed",
+			chapters: []probe.Chapter{
+				{Start: 0, End: 90, Title: "Chapter 1"},
+				{Start: 90, End: 1300, Title: "Chapter 2"},
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			intro, outro := chapterRanges(testCase.chapters)
+			for _, c := range []struct {
+				name             string
+				expected, actual *Range
+			}{{"intro", testCase.intro, intro}, {"outro", testCase.outro, outro}} {
+				if (c.expected == nil) != (c.actual == nil) ||
+					(c.expected != nil && *c.expected != *c.actual) {
+					t.Errorf("%s: expected %+v, got %+v", c.name, c.expected, c.actual)
+				}
+			}
+		})
+	}
+}
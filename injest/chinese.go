@@ -16,11 +16,13 @@ const (
 	bahamutURL       = "https://acg.gamer.com.tw/acgDetail.php?s=%s"
 	wikiDataEndpoint = "https://query.wikidata.org/sparql"
 	wikiDataQuery    = `
-		SELECT ?label ?bangumi ?bahamut WHERE {
+		SELECT ?label (LANG(?label) AS ?lang) ?bangumi ?bahamut ?mal ?kitsu ?anidb ?tmdbtv ?tmdbmovie WHERE {
 			?item p:P8729/ps:P8729 "%d".
 			OPTIONAL {
 				?item rdfs:label ?label.
-				FILTER(LANG(?label) = "zh")
+				FILTER(LANG(?label) IN (
+					"zh", "zh-hans", "zh-cn", "zh-sg", "zh-my",
+					"zh-hant", "zh-tw", "zh-hk", "zh-mo"))
 			}
 			OPTIONAL {
 				?item p:P5732/ps:P5732 ?bangumi.
@@ -28,12 +30,37 @@ const (
 			OPTIONAL {
 				?item p:P6367/ps:P6367 ?bahamut.
 			}
+			OPTIONAL {
+				?item p:P4086/ps:P4086 ?mal.
+			}
+			OPTIONAL {
+				?item p:P11495/ps:P11495 ?kitsu.
+			}
+			OPTIONAL {
+				?item p:P5646/ps:P5646 ?anidb.
+			}
+			OPTIONAL {
+				?item p:P4983/ps:P4983 ?tmdbtv.
+			}
+			OPTIONAL {
+				?item p:P4947/ps:P4947 ?tmdbmovie.
+			}
 		}
 	`
 )
 
 var (
 	bahamutMatcher = regexp.MustCompile(`<h1>(.*?)</h1>`)
+	// Mapping of WikiData query variables to external ID keys.
+	wikiDataIDs = map[string]string{
+		"bangumi":   IDBangumi,
+		"bahamut":   IDBahamut,
+		"mal":       IDMyAnimeList,
+		"kitsu":     IDKitsu,
+		"anidb":     IDAniDB,
+		"tmdbtv":    IDTMDBTV,
+		"tmdbmovie": IDTMDBMovie,
+	}
 )
 
 type wikiDataResponse struct {
@@ -44,11 +71,45 @@ type wikiDataResponse struct {
 	} `json:"results"`
 }
 
-// Get the Chinese title, given the AniList ID.
-func getChineseTitle(ctx context.Context, aniListID int, log *logrus.Entry) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wikiDataEndpoint, http.NoBody)
+// externalIDs returns the external IDs in the response, keyed by the ID*
+// constants.  If there are multiple values, the first one is used.
+func (r *wikiDataResponse) externalIDs() map[string]string {
+	ids := make(map[string]string)
+	for _, binding := range r.Results.Bindings {
+		for name, key := range wikiDataIDs {
+			if value := binding[name].Value; value != "" {
+				if _, ok := ids[key]; !ok {
+					ids[key] = value
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// chineseTitles returns the Chinese labels in the response, keyed by language
+// tag.  If there are multiple labels for a tag, the first one is used.
+func (r *wikiDataResponse) chineseTitles() map[string]string {
+	titles := make(map[string]string)
+	for _, binding := range r.Results.Bindings {
+		if label := binding["label"].Value; label != "" {
+			tag := normalizeChineseTag(binding["lang"].Value)
+			if _, ok := titles[tag]; !ok {
+				titles[tag] = label
+			}
+		}
+	}
+	return titles
+}
+
+// Get the Chinese titles keyed by language tag, given the AniList ID, from the
+// WikiData SPARQL endpoint.  This also returns any external IDs found along the
+// way, even if no title was found; the IDs are nil if WikiData could not be
+// queried.
+func getChineseTitles(ctx context.Context, endpoint string, aniListID int, log *logrus.Entry) (map[string]string, map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, http.NoBody)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 	req.Header.Set("User-Agent", userAgent)
 	req.Header.Set("Accept", "application/sparql-results+json")
@@ -57,43 +118,45 @@ func getChineseTitle(ctx context.Context, aniListID int, log *logrus.Entry) (str
 	req.URL.RawQuery = q.Encode()
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 	log.WithField("url", req.URL).Debug("Sent wikidata request")
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to get wikidata response: %d (%s)", resp.StatusCode, resp.Status)
+		return nil, nil, fmt.Errorf("failed to get wikidata response: %d (%s)", resp.StatusCode, resp.Status)
 	}
 	if resp.Body == nil {
-		return "", fmt.Errorf("failed to get wikidata response body")
+		return nil, nil, fmt.Errorf("failed to get wikidata response body")
 	}
 	defer resp.Body.Close()
 
 	var output wikiDataResponse
 	if err := json.NewDecoder(resp.Body).Decode(&output); err != nil {
-		return "", fmt.Errorf("failed to parse wikidata response: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse wikidata response: %w", err)
 	}
 	log.Debugf("Got WikiData resposne: %+v", output)
-	for _, binding := range output.Results.Bindings {
-		if binding["label"].Value != "" {
-			return binding["label"].Value, nil
-		}
-		if binding["bangumi"].Value != "" {
-			result, err := getBangumiTitle(ctx, binding["bangumi"].Value)
-			if err == nil {
-				return result, nil
-			}
+	ids := output.externalIDs()
+	titles := output.chineseTitles()
+	// Bangumi has simplified Chinese titles, and Bahamut has traditional ones;
+	// use them if WikiData was missing either.
+	if id := ids[IDBangumi]; id != "" && titles[LangSimplified] == "" {
+		if result, err := getBangumiTitle(ctx, id); err == nil {
+			titles[LangSimplified] = result
+		} else {
 			log.WithError(err).Error("failed to title from bangumi")
 		}
-		if binding["bahamut"].Value != "" {
-			result, err := getBahamutTitle(ctx, binding["bahamut"].Value)
-			if err == nil {
-				return result, nil
-			}
+	}
+	if id := ids[IDBahamut]; id != "" && titles[LangTraditional] == "" {
+		if result, err := getBahamutTitle(ctx, id); err == nil {
+			titles[LangTraditional] = result
+		} else {
 			log.WithError(err).Error("failed to title from bahamut")
 		}
 	}
 
-	return "", fmt.Errorf("failed to get Chinese title")
+	if len(titles) < 1 {
+		return nil, ids, fmt.Errorf("failed to get Chinese title")
+	}
+	return titles, ids, nil
 }
 
 // Get the Chinese title given the Bangumi id
@@ -0,0 +1,70 @@
+package injest
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wikiDataFixture is a canned WikiData response; each binding is one
+// combination of the optional values.
+const wikiDataFixture = `{
+	"head": {"vars": ["label", "lang", "bangumi", "bahamut", "mal", "kitsu", "anidb", "tmdbtv", "tmdbmovie"]},
+	"results": {"bindings": [
+		{
+			"label": {"xml:lang": "zh-hant", "type": "literal", "value": "進擊的巨人"},
+			"lang": {"type": "literal", "value": "zh-hant"},
+			"bangumi": {"type": "literal", "value": "55770"},
+			"mal": {"type": "literal", "value": "16498"},
+			"anidb": {"type": "literal", "value": "9541"}
+		},
+		{
+			"label": {"xml:lang": "zh-cn", "type": "literal", "value": "进击的巨人"},
+			"lang": {"type": "literal", "value": "zh-cn"},
+			"bangumi": {"type": "literal", "value": "99999"},
+			"kitsu": {"type": "literal", "value": "7442"},
+			"other": {"type": "literal", "value": "ignored"}
+		}
+	]}
+}`
+
+// fakeWikiData starts a stand-in for the WikiData SPARQL endpoint, which
+// replies with wikiDataFixture, or fails with the given status.
+func fakeWikiData(t *testing.T, status int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/sparql-results+json")
+		_, _ = w.Write([]byte(wikiDataFixture))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWikiDataResponse(t *testing.T) {
+	var response wikiDataResponse
+	if err := json.NewDecoder(strings.NewReader(wikiDataFixture)).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	expectedIDs := map[string]string{
+		IDBangumi:     "55770",
+		IDMyAnimeList: "16498",
+		IDAniDB:       "9541",
+		IDKitsu:       "7442",
+	}
+	if actual := response.externalIDs(); !maps.Equal(actual, expectedIDs) {
+		t.Errorf("expected IDs %v, got %v", expectedIDs, actual)
+	}
+	expectedTitles := map[string]string{
+		LangTraditional: "進擊的巨人",
+		LangSimplified:  "进击的巨人",
+	}
+	if actual := response.chineseTitles(); !maps.Equal(actual, expectedTitles) {
+		t.Errorf("expected titles %v, got %v", expectedTitles, actual)
+	}
+}
@@ -0,0 +1,280 @@
+package injest
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Formats for exported watch state.
+const (
+	ExportJSON = "json"
+	ExportCSV  = "csv"
+)
+
+// Strategies for merging imported watch state with the existing state.
+const (
+	// Imported state replaces the existing state.
+	ImportOverwrite = "overwrite"
+	// Files are seen if they are seen in either.
+	ImportUnion = "union"
+	// The most recently marked state wins.
+	ImportNewest = "newest"
+)
+
+// ImportStrategies lists the valid strategies for Import.
+var ImportStrategies = []string{ImportOverwrite, ImportUnion, ImportNewest}
+
+// ExportRecord is the watch state of a single media file.
+type ExportRecord struct {
+	// The path to the file, relative to the media root, with forward slashes.
+	Path string `json:"path"`
+	// The AniList ID of the directory containing the file, if known.
+	AniListID int  `json:"anilist,omitempty"`
+	Seen      bool `json:"seen"`
+	// When the file was last marked as seen or unseen, if known.
+	Marked time.Time `json:"marked,omitzero"`
+}
+
+// ImportChange describes a change to the seen state of a file from an import.
+type ImportChange struct {
+	Path string `json:"path"`
+	From bool   `json:"from"`
+	To   bool   `json:"to"`
+}
+
+var exportCSVHeader = []string{"path", "anilist", "seen", "marked"}
+
+// Export collects the watch state of every media file under root.
+func Export(store Store, root string) ([]ExportRecord, error) {
+	var records []ExportRecord
+	err := store.Walk(func(directory string, info *InfoType) error {
+		rel, err := filepath.Rel(root, directory)
+		if err != nil {
+			return err
+		}
+		for name, seen := range info.Seen {
+			record := ExportRecord{
+				Path:      path.Join(filepath.ToSlash(rel), name),
+				AniListID: max(info.AniListID, 0),
+				Seen:      seen,
+			}
+			if file := info.Files[name]; file != nil {
+				record.Marked = file.Marked
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	slices.SortFunc(records, func(a, b ExportRecord) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return records, err
+}
+
+// WriteExport writes exported records in the given format.
+func WriteExport(w io.Writer, format string, records []ExportRecord) error {
+	switch format {
+	case ExportJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case ExportCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportCSVHeader); err != nil {
+			return err
+		}
+		for _, record := range records {
+			marked := ""
+			if !record.Marked.IsZero() {
+				marked = record.Marked.Format(time.RFC3339)
+			}
+			err := writer.Write([]string{
+				record.Path,
+				strconv.Itoa(record.AniListID),
+				strconv.FormatBool(record.Seen),
+				marked,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// ReadExport reads records previously written by WriteExport.
+func ReadExport(r io.Reader, format string) ([]ExportRecord, error) {
+	var records []ExportRecord
+	switch format {
+	case ExportJSON:
+		if err := json.NewDecoder(r).Decode(&records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	case ExportCSV:
+		rows, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) < 1 || !slices.Equal(rows[0], exportCSVHeader) {
+			return nil, fmt.Errorf("invalid CSV header, expected %v", exportCSVHeader)
+		}
+		for n, row := range rows[1:] {
+			record := ExportRecord{Path: row[0]}
+			if record.AniListID, err = strconv.Atoi(row[1]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid AniList ID: %w", n+2, err)
+			}
+			if record.Seen, err = strconv.ParseBool(row[2]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid seen state: %w", n+2, err)
+			}
+			if row[3] != "" {
+				if record.Marked, err = time.Parse(time.RFC3339, row[3]); err != nil {
+					return nil, fmt.Errorf("line %d: invalid time: %w", n+2, err)
+				}
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// merge returns the seen state of a file after importing a record.
+func merge(strategy string, seen bool, marked time.Time, record ExportRecord) bool {
+	switch strategy {
+	case ImportOverwrite:
+		return record.Seen
+	case ImportUnion:
+		return seen || record.Seen
+	case ImportNewest:
+		if record.Marked.After(marked) {
+			return record.Seen
+		}
+	}
+	return seen
+}
+
+// Import merges exported watch state into the library under root, returning the
+// changes made.  Records are matched by path; if the path no longer exists,
+// they are matched by file name in a directory with the same AniList ID.  If
+// dryRun is set, the changes are only reported.
+func Import(store Store, root string, records []ExportRecord, strategy string, dryRun bool) ([]ImportChange, error) {
+	if !slices.Contains(ImportStrategies, strategy) {
+		return nil, fmt.Errorf("unknown import strategy %q", strategy)
+	}
+
+	// Directories by AniList ID, in case the media was moved.
+	byID := make(map[int]string)
+	err := store.Walk(func(directory string, info *InfoType) error {
+		if info.AniListID > 0 {
+			byID[info.AniListID] = directory
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make(map[string]*InfoType)
+	readInfo := func(directory string) *InfoType {
+		if _, ok := infos[directory]; !ok {
+			// Directories that were removed can't be read; skip them.
+			infos[directory], _ = store.ReadInfo(directory, true)
+		}
+		return infos[directory]
+	}
+
+	var changes []ImportChange
+	updates := make(map[string][]importUpdate)
+	for _, record := range records {
+		rel := filepath.FromSlash(record.Path)
+		if !filepath.IsLocal(rel) {
+			return nil, fmt.Errorf("invalid path %q", record.Path)
+		}
+		directory, name := filepath.Split(filepath.Join(root, rel))
+		directory = filepath.Clean(directory)
+		info := readInfo(directory)
+		if info == nil || !hasKey(info.Seen, name) {
+			if directory = byID[record.AniListID]; record.AniListID < 1 || directory == "" {
+				continue // Nowhere to import to.
+			}
+			if info = readInfo(directory); info == nil || !hasKey(info.Seen, name) {
+				continue
+			}
+		}
+		from := info.Seen[name]
+		if !importRecord(info, name, record, strategy) {
+			continue
+		}
+		filePath, _ := filepath.Rel(root, filepath.Join(directory, name))
+		changes = append(changes, ImportChange{
+			Path: filepath.ToSlash(filePath),
+			From: from,
+			To:   info.Seen[name],
+		})
+		updates[directory] = append(updates[directory], importUpdate{name, record})
+	}
+
+	if dryRun {
+		return changes, nil
+	}
+	// Apply the records again to the current state of each directory, as it
+	// may have changed while reading.
+	for directory, directoryUpdates := range updates {
+		err := store.Update(directory, true, func(info *InfoType) error {
+			for _, update := range directoryUpdates {
+				if hasKey(info.Seen, update.name) {
+					importRecord(info, update.name, update.record, strategy)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return changes, err
+		}
+		if err := UpdateRuntime(store, root, directory); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// importUpdate is a record to be imported into the file with the given name.
+type importUpdate struct {
+	name   string
+	record ExportRecord
+}
+
+// importRecord applies an imported record to a file, returning whether its
+// seen state changed.
+func importRecord(info *InfoType, name string, record ExportRecord, strategy string) bool {
+	var marked time.Time
+	if file := info.Files[name]; file != nil {
+		marked = file.Marked
+	}
+	seen := merge(strategy, info.Seen[name], marked, record)
+	if seen == info.Seen[name] {
+		return false
+	}
+	info.SetSeen(name, seen)
+	if !record.Marked.IsZero() {
+		info.File(name).Marked = record.Marked
+	}
+	return true
+}
+
+// hasKey checks if a map contains the given key.
+func hasKey[K comparable, V any](m map[K]V, key K) bool {
+	_, ok := m[key]
+	return ok
+}
@@ -0,0 +1,108 @@
+package injest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExportFormats(t *testing.T) {
+	records := []ExportRecord{
+		{Path: "show/1.mkv", AniListID: 42, Seen: true, Marked: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{Path: "show/2, with comma.mkv", AniListID: 42},
+	}
+	for _, format := range []string{ExportJSON, ExportCSV} {
+		t.Run(format, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			if err := WriteExport(&buf, format, records); err != nil {
+				t.Fatal(err)
+			}
+			actual, err := ReadExport(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(actual, records, func(a, b ExportRecord) bool {
+				return a.Path == b.Path && a.AniListID == b.AniListID && a.Seen == b.Seen && a.Marked.Equal(b.Marked)
+			}) {
+				t.Errorf("expected %+v, got %+v", records, actual)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	old, recent := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	records := []ExportRecord{
+		{Path: "show/1.mkv", Seen: true, Marked: old},
+		{Path: "show/2.mkv", Seen: false, Marked: recent},
+		{Path: "gone/3.mkv", AniListID: 42, Seen: true, Marked: recent},
+		{Path: "gone/4.mkv", Seen: true},
+	}
+	testCases := []struct {
+		strategy string
+		expected map[string]bool
+	}{
+		{ImportOverwrite, map[string]bool{"1.mkv": true, "2.mkv": false, "3.mkv": true}},
+		{ImportUnion, map[string]bool{"1.mkv": true, "2.mkv": true, "3.mkv": true}},
+		{ImportNewest, map[string]bool{"1.mkv": false, "2.mkv": false, "3.mkv": true}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.strategy, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			show := filepath.Join(root, "show")
+			if err := os.Mkdir(show, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"1.mkv", "2.mkv", "3.mkv"} {
+				if err := os.WriteFile(filepath.Join(show, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			store := newTestStore(t, "sidecar", root)
+			err := store.WriteInfo(show, &InfoType{
+				AniListID: 42,
+				Seen:      map[string]bool{"1.mkv": false, "2.mkv": true, "3.mkv": false},
+				Files: map[string]*FileInfo{
+					"1.mkv": {Marked: time.Now()},
+					"2.mkv": {Marked: time.Now()},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changes, err := Import(store, root, records, testCase.strategy, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := store.ReadInfo(show, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Seen["3.mkv"] {
+				t.Errorf("dry run changed state")
+			}
+			if _, err := Import(store, root, records, testCase.strategy, false); err != nil {
+				t.Fatal(err)
+			}
+			if info, err = store.ReadInfo(show, false); err != nil {
+				t.Fatal(err)
+			}
+			for name, expected := range testCase.expected {
+				if info.Seen[name] != expected {
+					t.Errorf("expected %s to be %v, got %v", name, expected, info.Seen[name])
+				}
+			}
+			for _, change := range changes {
+				if info.Seen[filepath.Base(change.Path)] != change.To {
+					t.Errorf("dry run reported %+v, but got %v", change, info.Seen[filepath.Base(change.Path)])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package injest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// HistoryBaseName is the default file name of the history log.
+const HistoryBaseName = ".history.jsonl"
+
+// HistoryEvent records a media file being marked as seen or not seen.
+type HistoryEvent struct {
+	Time time.Time `json:"time"`
+	// Who made the change: the authenticated user, or the client address.
+	User string `json:"user,omitempty"`
+	// The path to the file relative to the media root, with forward slashes.
+	Path string `json:"path"`
+	Seen bool   `json:"seen"`
+	// Identifies the request that made the change, so that it can be undone.
+	Operation string `json:"operation,omitempty"`
+}
+
+// History is an append-only log of history events, kept as one JSON object per
+// line.  A nil History records nothing.
+type History struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewHistory returns a history log kept at the given path.
+func NewHistory(path string) *History {
+	return &History{path: path}
+}
+
+// Append adds events to the end of the log.
+func (h *History) Append(events ...HistoryEvent) error {
+	if h == nil || len(events) < 1 {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Write all events at once, so that concurrent writers don't interleave.
+	var data []byte
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Read returns all events in the log, oldest first.  Lines that can't be
+// parsed (e.g. from an interrupted write) are skipped.
+func (h *History) Read() ([]HistoryEvent, error) {
+	if h == nil {
+		return nil, nil
+	}
+	f, err := os.Open(h.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var events []HistoryEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event HistoryEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// Operation returns the events recorded for the given operation, oldest first.
+func (h *History) Operation(operation string) ([]HistoryEvent, error) {
+	events, err := h.Read()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(events, func(event HistoryEvent) bool {
+		return event.Operation != operation
+	}), nil
+}
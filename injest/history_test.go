@@ -0,0 +1,78 @@
+package injest
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+	historyPath := filepath.Join(t.TempDir(), "state", HistoryBaseName)
+	history := NewHistory(historyPath)
+
+	// Nothing logged yet.
+	events, err := history.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) > 0 {
+		t.Errorf("expected no events, got %+v", events)
+	}
+
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var wg sync.WaitGroup
+	for _, name := range []string{"1.mkv", "2.mkv", "3.mkv"} {
+		wg.Go(func() {
+			err := history.Append(
+				HistoryEvent{Time: when, User: "user", Path: "show/" + name, Seen: true},
+				HistoryEvent{Time: when, User: "user", Path: "show/" + name, Seen: false},
+			)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	// Simulate an interrupted write.
+	f, err := os.OpenFile(historyPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"time":`); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if events, err = history.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 6 {
+		t.Fatalf("expected 6 events, got %+v", events)
+	}
+	for n := 0; n < len(events); n += 2 {
+		// Events appended together stay together.
+		first, second := events[n], events[n+1]
+		if first.Path != second.Path || !first.Seen || second.Seen {
+			t.Errorf("unexpected events %+v and %+v", first, second)
+		}
+		if !first.Time.Equal(when) || first.User != "user" {
+			t.Errorf("unexpected event %+v", first)
+		}
+	}
+	paths := make([]string, 0, len(events))
+	for _, event := range events {
+		paths = append(paths, event.Path)
+	}
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+	if !slices.Equal(paths, []string{"show/1.mkv", "show/2.mkv", "show/3.mkv"}) {
+		t.Errorf("unexpected paths %v", paths)
+	}
+}
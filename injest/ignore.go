@@ -0,0 +1,215 @@
+package injest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// IgnoreBaseName is the name of files listing patterns of files and directories
+// to ignore, in the same syntax as `.gitignore` files.  Patterns apply to the
+// directory containing the file and all of its children.
+const IgnoreBaseName = ".videoignore"
+
+// DefaultIgnore is the default patterns to ignore everywhere: metadata
+// directories created by NAS software.
+var DefaultIgnore = []string{"@eaDir/", `\#recycle/`}
+
+// ignorePattern is a single parsed ignore pattern.
+type ignorePattern struct {
+	// The absolute path of the directory the pattern is relative to.
+	base string
+	// The glob for each path segment; if the pattern is not anchored, this
+	// has a single element matched against the name only.
+	segments []string
+	// Whether the pattern re-includes matching entries.
+	negate bool
+	// Whether the pattern only matches directories.
+	dirOnly bool
+	// Whether the pattern is matched against the whole path from base.
+	anchored bool
+}
+
+// parseIgnorePattern parses a single line of an ignore file; ok is false if
+// it does not contain a pattern.
+func parseIgnorePattern(base, line string) (pattern ignorePattern, ok bool) {
+	pattern.base = base
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern, false
+	}
+	// Trailing spaces are ignored unless escaped.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		pattern.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return pattern, false
+	}
+	pattern.segments = strings.Split(line, "/")
+	for _, segment := range pattern.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return pattern, false // Malformed pattern.
+		}
+	}
+	return pattern, true
+}
+
+// parseIgnore parses the patterns in an ignore file.
+func parseIgnore(base string, r io.Reader) ([]ignorePattern, error) {
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if pattern, ok := parseIgnorePattern(base, scanner.Text()); ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// matchSegments matches path segments against glob segments, where "**"
+// matches any number of segments.
+func matchSegments(globs, parts []string) bool {
+	if len(globs) == 0 {
+		return len(parts) == 0
+	}
+	if globs[0] == "**" {
+		for skip := 0; skip <= len(parts); skip++ {
+			if matchSegments(globs[1:], parts[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(globs[0], parts[0]); !matched {
+		return false
+	}
+	return matchSegments(globs[1:], parts[1:])
+}
+
+// match checks if the pattern matches an absolute path.
+func (p *ignorePattern) match(absPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if !p.anchored {
+		matched, _ := path.Match(p.segments[0], filepath.Base(absPath))
+		return matched
+	}
+	rel, err := filepath.Rel(p.base, absPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return false
+	}
+	return matchSegments(p.segments, strings.Split(filepath.ToSlash(rel), "/"))
+}
+
+// ignoreRules are the patterns that apply to the entries of a directory.
+type ignoreRules struct {
+	directory string
+	patterns  []ignorePattern
+	// Identifies the global patterns and the contents of the ignore files the
+	// patterns came from, so that changes to them can be noticed; empty if
+	// there are none.
+	hash string
+}
+
+// ignored checks if an entry in the directory should be ignored; the last
+// matching pattern wins.
+func (r *ignoreRules) ignored(name string, isDir bool) bool {
+	absPath := filepath.Join(r.directory, name)
+	ignored := false
+	for _, pattern := range r.patterns {
+		if pattern.match(absPath, isDir) {
+			ignored = !pattern.negate
+		}
+	}
+	return ignored
+}
+
+// ignoreRules collects the patterns that apply to the entries of a directory
+// under root: the global patterns, then those from the ignore files in each
+// directory from the root down.  Unreadable ignore files are logged and
+// skipped.
+func (m *MediaTypes) ignoreRules(root, directory string) *ignoreRules {
+	if m == nil {
+		m = defaultMediaTypes
+	}
+	rules := &ignoreRules{directory: root}
+	for _, line := range m.ignore {
+		if pattern, ok := parseIgnorePattern(root, line); ok {
+			rules.patterns = append(rules.patterns, pattern)
+		}
+	}
+	if len(m.ignore) > 0 {
+		hash := sha256.New()
+		for _, line := range m.ignore {
+			_, _ = fmt.Fprintf(hash, "%s\x00", line)
+		}
+		rules.hash = fmt.Sprintf("%x", hash.Sum(nil)[:16])
+	}
+	rel, err := filepath.Rel(root, directory)
+	if err != nil || !filepath.IsLocal(rel) {
+		return rules.descend(directory)
+	}
+	rules = rules.descend(root)
+	for part := range strings.SplitSeq(rel, string(filepath.Separator)) {
+		if part != "." {
+			rules = rules.descend(filepath.Join(rules.directory, part))
+		}
+	}
+	return rules
+}
+
+// descend returns the rules for a child directory, adding the patterns from
+// its ignore file if any.
+func (r *ignoreRules) descend(directory string) *ignoreRules {
+	child := &ignoreRules{
+		directory: directory,
+		patterns:  slices.Clip(r.patterns),
+		hash:      r.hash,
+	}
+	data, err := os.ReadFile(filepath.Join(directory, IgnoreBaseName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return child
+	} else if err != nil {
+		logrus.WithError(err).WithField("directory", directory).Error("Failed to read ignore file")
+		return child
+	}
+	patterns, err := parseIgnore(directory, bytes.NewReader(data))
+	if err != nil {
+		logrus.WithError(err).WithField("directory", directory).Error("Failed to read ignore file")
+	}
+	child.patterns = append(child.patterns, patterns...)
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\x00%s\x00", r.hash, directory)
+	_, _ = hash.Write(data)
+	child.hash = fmt.Sprintf("%x", hash.Sum(nil)[:16])
+	return child
+}
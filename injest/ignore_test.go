@@ -0,0 +1,180 @@
+package injest
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIgnorePattern(t *testing.T) {
+	base := filepath.FromSlash("/media")
+	testCases := []struct {
+		line    string
+		path    string
+		isDir   bool
+		ok      bool
+		matched bool
+		negate  bool
+	}{
+		{line: "", ok: false},
+		{line: "# comment", ok: false},
+		{line: "/", ok: false},
+		{line: "*NCOP*", path: "Show/Show NCOP1.mkv", ok: true, matched: true},
+		{line: "*NCOP*", path: "Show NCOP/01.mkv", ok: true, matched: false},
+		{line: "sample.mkv   ", path: "Show/sample.mkv", ok: true, matched: true},
+		{line: `trailing\ `, path: "Show/trailing ", ok: true, matched: true},
+		{line: "Extras/", path: "Show/Extras", isDir: true, ok: true, matched: true},
+		{line: "Extras/", path: "Show/Extras", isDir: false, ok: true, matched: false},
+		{line: "/Extras", path: "Extras", isDir: true, ok: true, matched: true},
+		{line: "/Extras", path: "Show/Extras", isDir: true, ok: true, matched: false},
+		{line: "Show/*.txt", path: "Show/notes.txt", ok: true, matched: true},
+		{line: "Show/*.txt", path: "Other/Show/notes.txt", ok: true, matched: false},
+		{line: "**/Samples", path: "Show/Season 1/Samples", isDir: true, ok: true, matched: true},
+		{line: "Show/**/*.nfo", path: "Show/a/b/c.nfo", ok: true, matched: true},
+		{line: "Show/**/*.nfo", path: "Show/c.nfo", ok: true, matched: true},
+		{line: `\#recycle/`, path: "#recycle", isDir: true, ok: true, matched: true},
+		{line: `\!important`, path: "!important", ok: true, matched: true},
+		{line: "!keep.mkv", path: "Show/keep.mkv", ok: true, matched: true, negate: true},
+		{line: "[", ok: false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.line+"|"+testCase.path, func(t *testing.T) {
+			t.Parallel()
+			pattern, ok := parseIgnorePattern(base, testCase.line)
+			if ok != testCase.ok {
+				t.Fatalf("expected ok %v, got %v", testCase.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			if pattern.negate != testCase.negate {
+				t.Errorf("expected negate %v, got %v", testCase.negate, pattern.negate)
+			}
+			absPath := filepath.Join(base, filepath.FromSlash(testCase.path))
+			if matched := pattern.match(absPath, testCase.isDir); matched != testCase.matched {
+				t.Errorf("expected match %v, got %v", testCase.matched, matched)
+			}
+		})
+	}
+}
+
+func TestIgnoreFiles(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	show := filepath.Join(root, "Show")
+	files := map[string]string{
+		IgnoreBaseName:           "Extras/\n*NCOP*\n",
+		"Show/" + IgnoreBaseName: "!*NCOP2*\nsample.mkv\n",
+		"Show/01.mkv":            "",
+		"Show/NCOP1.mkv":         "",
+		"Show/NCOP2.mkv":         "",
+		"Show/sample.mkv":        "",
+		"Show/Extras/01.mkv":     "",
+		"Show/Season 2/01.mkv":   "",
+		"Show/@eaDir/01.mkv":     "",
+		"Show/#recycle/01.mkv":   "",
+		"Other/sample.mkv":       "",
+	}
+	for name, contents := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := newTestStore(t, "state", root)
+	info, err := store.ReadInfo(show, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedSeen := []string{"01.mkv", "NCOP2.mkv"}
+	if actual := slices.Sorted(maps.Keys(info.Seen)); !slices.Equal(actual, expectedSeen) {
+		t.Errorf("expected files %v, got %v", expectedSeen, actual)
+	}
+	expectedDirs := []string{"Season 2"}
+	if actual := slices.Sorted(maps.Keys(info.Injested)); !slices.Equal(actual, expectedDirs) {
+		t.Errorf("expected directories %v, got %v", expectedDirs, actual)
+	}
+
+	// Patterns in a subdirectory don't apply to its siblings.
+	other, err := store.ReadInfo(filepath.Join(root, "Other"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := other.Seen["sample.mkv"]; !ok {
+		t.Errorf("expected sample.mkv outside Show to be listed, got %v", other.Seen)
+	}
+}
+
+func TestIgnoreParentChanged(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	show := filepath.Join(root, "Show")
+	season := filepath.Join(show, "Season 1")
+	if err := os.MkdirAll(season, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(season, "01.mkv"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	media, err := NewMediaTypes(MediaOptions{Ignore: DefaultIgnore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := New(root, Options{MediaTypes: media})
+	// Having an ID already means injesting doesn't query AniList.
+	if err := i.store.WriteInfo(season, &InfoType{AniListID: 42}); err != nil {
+		t.Fatal(err)
+	}
+	// scan injests everything from the root, returning whether the season was
+	// rescanned.
+	scan := func() bool {
+		t.Helper()
+		rescanned := false
+		i.pending = []task{&injestDirectory{i: i}}
+		for len(i.pending) > 0 {
+			var next task
+			i.pending, next = i.pending[:len(i.pending)-1], i.pending[len(i.pending)-1]
+			switch next := next.(type) {
+			case *injestDirectory:
+				if err := next.Process(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			case *createThumbnail:
+				rescanned = rescanned || filepath.Dir(next.absPath) == season
+			}
+		}
+		return rescanned
+	}
+
+	if !scan() {
+		t.Fatal("new directory was not scanned")
+	}
+	if scan() {
+		t.Error("unchanged directory was rescanned")
+	}
+	for _, contents := range []string{"*NCOP*\n", "*NCED*\n"} {
+		if err := os.WriteFile(filepath.Join(show, IgnoreBaseName), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if !scan() {
+			t.Errorf("directory was not rescanned after parent ignore file changed to %q", contents)
+		}
+		if scan() {
+			t.Errorf("directory was rescanned again with parent ignore file %q", contents)
+		}
+	}
+	media.ignore = append(slices.Clone(DefaultIgnore), "*NCOP*")
+	if !scan() {
+		t.Error("directory was not rescanned after global ignore patterns changed")
+	}
+	if scan() {
+		t.Error("directory was rescanned again with the same global ignore patterns")
+	}
+}
@@ -2,76 +2,148 @@ package injest
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io/fs"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/mook/video-listing/probe"
 )
 
 const infoBaseName = ".info.json"
 
-var mediaExtensions = map[string]struct{}{
-	".asf":  {},
-	".avi":  {},
-	".f4v":  {},
-	".flv":  {},
-	".mkv":  {},
-	".mov":  {},
-	".mp4":  {},
-	".mpg":  {},
-	".ogv":  {},
-	".rm":   {},
-	".rmvb": {},
-	".webm": {},
-	".wmv":  {},
-}
+// Keys for external IDs in InfoType.ExternalIDs.
+const (
+	IDMyAnimeList = "mal"
+	IDKitsu       = "kitsu"
+	IDAniDB       = "anidb"
+	IDBangumi     = "bangumi"
+	IDBahamut     = "bahamut"
+	IDTMDBTV      = "tmdb-tv"
+	IDTMDBMovie   = "tmdb-movie"
+)
 
 // InfoType describes the data in `.info.json` files in each directory.
 type InfoType struct {
+	// The version of the format the information was saved in; see InfoVersion.
+	Version int `json:"version"`
 	// The last time injesting for this directory (not its children) was completed.
-	Timestamp    time.Time `json:"timestamp"`
-	AniListID    int       `json:"anilist,omitempty"`
-	NativeTitle  string    `json:"native,omitempty"`
-	EnglishTitle string    `json:"english,omitempty"`
-	ChineseTitle string    `json:"chinese,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	AniListID int       `json:"anilist,omitempty"`
+	// The number of episodes, according to AniList; zero if unknown.
+	Episodes int `json:"episodes,omitempty"`
+	// Titles of the media, keyed by language tag (see the Lang* constants).
+	// The first title in each language is the main one; any others are synonyms.
+	Titles map[string][]string `json:"titles,omitempty"`
+	// Titles in older versions of the file; these are migrated into Titles.
+	legacyTitles
+	// A low confidence match from searching AniList, awaiting confirmation.
+	Review *MatchReview `json:"review,omitempty"`
+	// Identifiers of the media in other databases, keyed by the ID* constants.
+	ExternalIDs map[string]string `json:"ids,omitempty"`
 	// Mapping of each media file to whether it's marked as seen.
 	Seen map[string]bool `json:"seen,omitempty"`
 	// Mapping of each child directory to when it was last injested (mtime).
 	Injested map[string]time.Time `json:"injested,omitempty"`
-	changed  bool
+	// The total durations of media in this directory and its children.
+	Runtime Runtime `json:"runtime"`
+	// Identifies the ignore files that applied to this directory when it was
+	// last injested; see IgnoreBaseName.
+	IgnoreHash string `json:"ignoreHash,omitempty"`
+	// The value of Timestamp when openings and endings were last detected.
+	IntrosDetected time.Time `json:"introsDetected,omitzero"`
+	// Mapping of each media file to information generated about it.
+	Files map[string]*FileInfo `json:"files,omitempty"`
+	// Mapping of removed media files to their state, so that it can be restored
+	// if they turn up elsewhere.
+	Orphans map[string]*Orphan `json:"orphans,omitempty"`
+	// Files in this directory that were found to have been renamed or moved.
+	Reassociations []Reassociation `json:"reassociations,omitempty"`
+	changed        bool
+	// Whether the saved information was in an older format.
+	migrated bool
 	// Mapping of file/directory name to modification time.
 	mtimes map[string]time.Time
 }
 
-// ReadInfo reads the saved information from a directory, given as the absolute
-// path.  It is not an error if the saved info does not exist.  The Seen and
-// Injested maps are filled to contain zero values.
-func ReadInfo(directory string, update bool) (*InfoType, error) {
-	infoPath := filepath.Join(directory, infoBaseName)
-	info := InfoType{
+// FileInfo describes information generated about a single media file.
+type FileInfo struct {
+	// The time, in seconds, of the frame used for the thumbnail.
+	Thumbnail *float64 `json:"thumbnail,omitempty"`
+	// Technical metadata about the file.
+	Probe *probe.Result `json:"probe,omitempty"`
+	// The opening and ending sequences, for players to offer to skip.
+	Intro *Range `json:"intro,omitempty"`
+	Outro *Range `json:"outro,omitempty"`
+	// Identifies the contents of the file (see fingerprintFile).
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// When the file was last marked as seen or unseen.
+	Marked time.Time `json:"marked,omitzero"`
+}
+
+// File returns the information about a media file, creating it if needed.
+func (info *InfoType) File(name string) *FileInfo {
+	if info.Files == nil {
+		info.Files = make(map[string]*FileInfo)
+	}
+	if info.Files[name] == nil {
+		info.Files[name] = &FileInfo{}
+	}
+	return info.Files[name]
+}
+
+// SetSeen marks a media file as seen or unseen, recording when it changed.
+func (info *InfoType) SetSeen(name string, seen bool) {
+	if current, ok := info.Seen[name]; ok && current == seen {
+		return
+	}
+	info.Seen[name] = seen
+	info.File(name).Marked = time.Now()
+	info.changed = true
+}
+
+type legacyTitles struct {
+	NativeTitle  string `json:"native,omitempty"`
+	EnglishTitle string `json:"english,omitempty"`
+	ChineseTitle string `json:"chinese,omitempty"`
+}
+
+// newInfo returns empty information, ready for saved information to be decoded
+// into.
+func newInfo() *InfoType {
+	return &InfoType{
 		Seen:     make(map[string]bool),
 		Injested: make(map[string]time.Time),
 		mtimes:   make(map[string]time.Time),
 	}
-	migrate := false
-	migratingSeen := make(map[string]bool)
-	f, err := os.Open(infoPath)
-	if err == nil {
-		defer f.Close()
-		if err := json.NewDecoder(f).Decode(&info); err != nil {
-			return nil, fmt.Errorf("failed to load saved info: %w", err)
-		}
-	} else if !errors.Is(err, fs.ErrNotExist) {
-		return nil, err
-	} else {
-		migrate = true
+}
+
+// decodeInfo parses saved information; it still needs to be migrated.
+func decodeInfo(r io.Reader, info *InfoType) error {
+	if err := json.NewDecoder(r).Decode(info); err != nil {
+		return fmt.Errorf("failed to load saved info: %w", err)
 	}
+	if info.Version == 0 {
+		info.Version = versionUnversioned // Saved before versioning.
+	}
+	return nil
+}
 
-	if !update && !migrate {
-		return &info, nil
+// refreshInfo finishes reading the information about a directory, given as the
+// absolute path; found is whether any information was saved.  The information
+// is migrated to the current version.  If update is set (or nothing was saved),
+// the directory is listed so that the Seen and Injested maps are filled to
+// contain zero values, and entries for removed files are dropped; media files
+// are those accepted by media, and not ignored by the rules for the directory
+// under root.
+func refreshInfo(root, directory string, info *InfoType, found, update bool, media *MediaTypes) (*InfoType, error) {
+	if err := migrateInfo(directory, info); err != nil {
+		return nil, err
+	}
+	if !update && found {
+		return info, nil
 	}
 
 	entries, err := os.ReadDir(directory)
@@ -79,21 +151,14 @@ func ReadInfo(directory string, update bool) (*InfoType, error) {
 		return nil, err
 	}
 	seen := make(map[string]bool)
+	rules := media.ignoreRules(root, directory)
 
 	for _, entry := range entries {
 		name := entry.Name()
-		if strings.HasPrefix(name, ".") {
-			if migrate && len(name) > 5 && strings.HasSuffix(name, ".seen") {
-				name := name[1 : len(name)-5]
-				migratingSeen[name] = true
-			}
-			continue
+		if strings.HasPrefix(name, ".") || rules.ignored(name, entry.IsDir()) {
+			continue // Ignored entries are dropped below.
 		}
 		if entry.IsDir() {
-			if name == "@eaDir" {
-				delete(info.Injested, name)
-				continue
-			}
 			if _, ok := info.Injested[name]; !ok {
 				info.Injested[name] = time.Time{}
 				info.changed = true
@@ -103,7 +168,7 @@ func ReadInfo(directory string, update bool) (*InfoType, error) {
 				info.mtimes[name] = stat.ModTime()
 			}
 		} else if entry.Type().IsRegular() {
-			if _, ok := mediaExtensions[strings.ToLower(filepath.Ext(name))]; !ok {
+			if !media.IsMedia(filepath.Join(directory, name), entry) {
 				continue // Not a media file
 			}
 			if _, ok := info.Seen[name]; !ok {
@@ -117,47 +182,43 @@ func ReadInfo(directory string, update bool) (*InfoType, error) {
 		}
 	}
 
-	if migrate {
-		for name := range info.Seen {
-			if migratingSeen[name] {
-				info.Seen[name] = true
-			}
-		}
-	}
-
 	for dir := range info.Injested {
 		if !seen[dir] {
 			delete(info.Injested, dir)
 			info.changed = true
 		}
 	}
+	// Remember removed files, in case they were renamed or moved.
+	for file, fileInfo := range info.Files {
+		if !seen[file] && fileInfo.Fingerprint != "" {
+			if info.Orphans == nil {
+				info.Orphans = make(map[string]*Orphan)
+			}
+			info.Orphans[file] = &Orphan{
+				Seen:    info.Seen[file],
+				File:    fileInfo,
+				Removed: time.Now(),
+			}
+		}
+	}
+	for file, orphan := range info.Orphans {
+		if time.Since(orphan.Removed) > orphanRetention {
+			delete(info.Orphans, file)
+			info.changed = true
+		}
+	}
 	for file := range info.Seen {
 		if !seen[file] {
 			delete(info.Seen, file)
 			info.changed = true
 		}
 	}
-
-	return &info, nil
-}
-
-func WriteInfo(directory string, info *InfoType) error {
-	infoPath := filepath.Join(directory, infoBaseName)
-	f, err := os.CreateTemp(directory, infoBaseName)
-	if err != nil {
-		return err
-	}
-	defer os.Remove(f.Name())
-	defer f.Close()
-	if err := json.NewEncoder(f).Encode(info); err != nil {
-		return err
-	}
-	if err := f.Close(); err != nil {
-		return err
-	}
-	if err := os.Rename(f.Name(), infoPath); err != nil {
-		return err
+	for file := range info.Files {
+		if !seen[file] {
+			delete(info.Files, file)
+			info.changed = true
+		}
 	}
 
-	return nil
+	return info, nil
 }
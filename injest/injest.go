@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mook/video-listing/probe"
 	"github.com/mook/video-listing/thumbnail"
 	"github.com/sirupsen/logrus"
 )
@@ -25,13 +26,83 @@ type Injester struct {
 	root    string
 	cond    *sync.Cond
 	pending []task
+	// The AniList GraphQL endpoint; this is overridden for testing.
+	aniListEndpoint string
+	// The WikiData SPARQL endpoint; this is overridden for testing.
+	wikiDataEndpoint string
+	// The AniList OAuth access token, if watch progress is to be synchronized.
+	aniListToken string
+	// The minimum time between requests to AniList.
+	aniListInterval time.Duration
+	// Rules to transform directory names into AniList searches.
+	titleTransforms []TitleTransform
+	// The interval between trickplay frames; zero to disable trickplay.
+	trickplayInterval time.Duration
+	// Whether to generate animated previews.
+	previews bool
+	// Where generated artifacts are stored.
+	artifacts *Artifacts
+	// Where information about directories is saved.
+	store Store
+	// Which files are media.
+	media *MediaTypes
+	// Fingerprinted files, to find those that were moved.
+	files fileIndex
+}
+
+// Options configures an Injester.
+type Options struct {
+	// AniList OAuth access token; if set, watch progress will be synchronized
+	// with the user's AniList list.
+	AniListToken string
+	// Rules for transforming directory names into AniList searches; if nil, the
+	// default rules are used.
+	TitleTransforms []TitleTransform
+	// The interval between frames in trickplay sprite sheets; if zero, no
+	// trickplay data is generated.
+	TrickplayInterval time.Duration
+	// Whether to generate animated previews of each video.
+	Previews bool
+	// Where to store generated artifacts; if nil, they are stored as hidden
+	// files next to the media.
+	Artifacts *Artifacts
+	// Where to save information about directories; if nil, it is saved next to
+	// the media.
+	Store Store
+	// Which files are media; if nil, the default extensions are used.  This
+	// should match the Store.
+	MediaTypes *MediaTypes
 }
 
 // Create a new Injester.
-func New(root string) *Injester {
+func New(root string, opts Options) *Injester {
+	transforms := opts.TitleTransforms
+	if transforms == nil {
+		var err error
+		if transforms, err = LoadTitleTransforms(""); err != nil {
+			panic(err) // The default rules are embedded; this can't fail.
+		}
+	}
+	if absRoot, err := filepath.Abs(root); err == nil {
+		root = absRoot // Paths are compared against those from the store.
+	}
+	store := opts.Store
+	if store == nil {
+		store = &JSONStore{root: root, media: opts.MediaTypes}
+	}
 	return &Injester{
-		root: root,
-		cond: sync.NewCond(&sync.Mutex{}),
+		root:              root,
+		cond:              sync.NewCond(&sync.Mutex{}),
+		aniListEndpoint:   aniListEndpoint,
+		wikiDataEndpoint:  wikiDataEndpoint,
+		aniListToken:      opts.AniListToken,
+		aniListInterval:   aniListInterval,
+		titleTransforms:   transforms,
+		trickplayInterval: opts.TrickplayInterval,
+		previews:          opts.Previews,
+		artifacts:         opts.Artifacts,
+		store:             store,
+		media:             opts.MediaTypes,
 	}
 }
 
@@ -42,6 +113,15 @@ type QueueOptions struct {
 	ID int
 	// Force rescan; ignored if ID is set.
 	Force bool
+	// Push the watch progress of the directory to AniList instead of scanning.
+	Push bool
+	// Import the watch progress from AniList into the directory and all of its
+	// children instead of scanning.
+	Pull bool
+	// Remove cached artifacts whose media no longer exists instead of scanning;
+	// the directory is ignored.  As the queue is LIFO, this runs once everything
+	// queued after it is done.
+	Collect bool
 }
 
 type Queue func(QueueOptions)
@@ -58,10 +138,25 @@ func (i *Injester) Queue(opts QueueOptions) {
 			return // Absolute path does not start with root
 		}
 	}
-	i.queue(&injestDirectory{
-		i:            i,
-		QueueOptions: opts,
-	})
+	switch {
+	case opts.Push:
+		if i.aniListToken != "" {
+			i.queue(&pushProgress{i: i, directory: opts.Directory})
+		}
+	case opts.Pull:
+		if i.aniListToken != "" {
+			i.queue(&pullProgress{i: i, directory: opts.Directory})
+		}
+	case opts.Collect:
+		if i.artifacts != nil {
+			i.queue(&collectArtifacts{i: i})
+		}
+	default:
+		i.queue(&injestDirectory{
+			i:            i,
+			QueueOptions: opts,
+		})
+	}
 }
 
 // queue a task for processing; the type of task may vary.
@@ -74,6 +169,17 @@ func (i *Injester) queue(task task) {
 	logrus.WithField("task", task).Debug("Injester queued item")
 }
 
+// outdated checks if a generated artifact, given as its sidecar path, is
+// missing or older than the media file it was generated from.
+func (i *Injester) outdated(mediaPath, artifactPath string) bool {
+	mediaInfo, err := os.Stat(mediaPath)
+	if err != nil {
+		return false // The media is gone; there's nothing to generate.
+	}
+	artifactInfo, err := os.Stat(i.artifacts.Path(artifactPath))
+	return err != nil || artifactInfo.ModTime().Before(mediaInfo.ModTime())
+}
+
 type injestDirectory struct {
 	i *Injester
 	QueueOptions
@@ -99,10 +205,11 @@ func (d *injestDirectory) Process(ctx context.Context) error {
 	var lastTime time.Time
 	directories := make(map[string]time.Time)
 	var files []string
+	rules := d.i.media.ignoreRules(d.i.root, d.absPath())
 	for _, entry := range entries {
 		name := entry.Name()
-		if strings.HasPrefix(name, ".") {
-			continue // Skip hidden files and directories.
+		if strings.HasPrefix(name, ".") || rules.ignored(name, entry.IsDir()) {
+			continue // Skip hidden and ignored files and directories.
 		}
 		info, err := entry.Info()
 		if err != nil {
@@ -110,15 +217,12 @@ func (d *injestDirectory) Process(ctx context.Context) error {
 			continue
 		}
 		if entry.IsDir() {
-			if name == "@eaDir" {
-				continue
-			}
 			directories[name] = info.ModTime()
 			if info.ModTime().After(lastTime) {
 				lastTime = info.ModTime()
 			}
 		} else if entry.Type().IsRegular() {
-			if _, ok := mediaExtensions[strings.ToLower(filepath.Ext(name))]; !ok {
+			if !d.i.media.probeMedia(ctx, filepath.Join(d.absPath(), name), entry) {
 				continue // Not a media file
 			}
 			files = append(files, name)
@@ -128,70 +232,141 @@ func (d *injestDirectory) Process(ctx context.Context) error {
 		}
 	}
 
-	info, err := ReadInfo(d.absPath(), true)
-	log.WithError(err).WithField("info", info).Debug("Read existing info")
+	// Save any probe results once per directory, rather than for each file.
+	if err := d.i.media.saveProbes(); err != nil {
+		log.WithError(err).Error("Failed to save probe results")
+	}
+
+	snapshot, err := d.i.store.ReadInfo(d.absPath(), true)
+	log.WithError(err).WithField("info", snapshot).Debug("Read existing info")
 	if err != nil {
 		return err
 	}
 
-	if d.Force || d.ID != info.AniListID || len(info.Seen) > 0 {
+	// Look up the media before taking the directory lock, as it may be slow;
+	// the results are copied into the current info afterwards.
+	requested := false
+	if d.Force || d.ID != snapshot.AniListID || len(snapshot.Seen) > 0 {
 		// This is a media directory; look up what it is.
+		snapshot.changed = false
 		if d.ID != 0 {
-			idChanged := info.AniListID != d.ID
-			info.AniListID = d.ID
-			err = d.i.requestInfo(ctx, d.absPath(), info, d.Force || idChanged, true)
+			idChanged := snapshot.AniListID != d.ID
+			if idChanged {
+				// What was found for the old ID no longer applies.
+				snapshot.Titles = nil
+				snapshot.ExternalIDs = nil
+			}
+			snapshot.AniListID = d.ID
+			err = d.i.requestInfo(ctx, d.absPath(), snapshot, d.Force || idChanged, true)
 		} else {
-			err = d.i.requestInfo(ctx, d.absPath(), info, d.Force, false)
+			err = d.i.requestInfo(ctx, d.absPath(), snapshot, d.Force, false)
 		}
-		log.WithError(err).WithField("info", info).Debug("Requested info")
+		log.WithError(err).WithField("info", snapshot).Debug("Requested info")
 		// Ignore any errors here; we can rescan later.
+		requested = snapshot.changed
 	}
 
-	if d.Force || lastTime.After(info.Timestamp) {
-		info.changed = true
-		info.Timestamp = lastTime
+	written := false
+	err = d.i.store.Update(d.absPath(), true, func(info *InfoType) error {
+		if requested || d.ID != 0 {
+			info.copyAniList(snapshot)
+			info.changed = info.changed || requested
+		}
+		// Rescan when the ignore patterns change, including those from the
+		// ignore files of parent directories.
+		ignoreChanged := rules.hash != info.IgnoreHash
+		changed := d.Force || lastTime.After(info.Timestamp) || ignoreChanged
+		if changed {
+			info.changed = true
+			info.Timestamp = lastTime
+			info.IgnoreHash = rules.hash
+		}
 
+		// The queue is LIFO; queue the probes last so that their results (and the
+		// intros detected from them) are available when creating thumbnails.
+		// Artifacts that are missing are generated even if nothing changed.
 		for _, child := range files {
-			d.i.queue(&createThumbnail{
-				i:       d.i,
-				absPath: filepath.Join(d.absPath(), child),
-			})
+			absPath := filepath.Join(d.absPath(), child)
+			if changed {
+				d.i.queue(&createThumbnail{
+					i:       d.i,
+					absPath: absPath,
+				})
+			}
+			if d.i.previews && (changed || d.i.outdated(absPath, PreviewPath(absPath))) {
+				d.i.queue(&createPreview{
+					i:       d.i,
+					absPath: absPath,
+				})
+			}
+			trickplayIndex := filepath.Join(TrickplayDir(absPath), thumbnail.TrickplayIndex)
+			if d.i.trickplayInterval > 0 && (changed || d.i.outdated(absPath, trickplayIndex)) {
+				d.i.queue(&createTrickplay{
+					i:       d.i,
+					absPath: absPath,
+				})
+			}
 		}
-	}
+		// Files scanned before probing was added (or where it failed) are probed
+		// even if nothing changed; the same goes for detecting intros.
+		if len(files) > 1 && (changed || info.IntrosDetected.Before(info.Timestamp)) {
+			d.i.queue(&detectIntros{i: d.i, absPath: d.absPath()})
+		}
+		for _, child := range files {
+			if file := info.Files[child]; changed || file == nil || file.Probe == nil {
+				d.i.queue(&probeFile{
+					i:       d.i,
+					absPath: filepath.Join(d.absPath(), child),
+				})
+			}
+		}
+		// Restore the state of renamed files before doing anything else.  Files
+		// can be moved in without changing the directory's timestamp, so this is
+		// done even if nothing changed.
+		d.i.queue(&trackFiles{i: d.i, absPath: d.absPath()})
 
-	// Update the subdirectories
-	for d := range info.Injested {
-		if _, ok := directories[d]; !ok {
-			delete(info.Injested, d)
+		// Update the subdirectories
+		for d := range info.Injested {
+			if _, ok := directories[d]; !ok {
+				delete(info.Injested, d)
+			}
 		}
-	}
-	for child, t := range directories {
-		if t.After(info.Injested[child]) {
-			d.i.queue(&injestDirectory{
-				i: d.i,
-				QueueOptions: QueueOptions{
-					Directory: filepath.Join(d.Directory, child),
-				},
-			})
-			info.changed = true
+		for child, t := range directories {
+			// Changed ignore patterns apply to the subdirectories too, even though
+			// their timestamps haven't changed.
+			if ignoreChanged || t.After(info.Injested[child]) {
+				d.i.queue(&injestDirectory{
+					i: d.i,
+					QueueOptions: QueueOptions{
+						Directory: filepath.Join(d.Directory, child),
+					},
+				})
+				info.changed = true
+			}
 		}
-	}
 
-	if info.changed {
+		if !info.changed {
+			log.Debugf("Skipping unchanged info: %+v", info)
+			return SkipWrite
+		}
 		// Update the last modified time
 		for _, t := range info.mtimes {
 			if t.After(info.Timestamp) {
 				info.Timestamp = t
 			}
 		}
-
-		err = WriteInfo(d.absPath(), info)
-		log.WithError(err).WithField("info", info).Debug("Wrote info")
-		if err != nil {
+		log.WithField("info", info).Debug("Writing info")
+		written = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if written {
+		// Files or subdirectories may have been removed.
+		if err := UpdateRuntime(d.i.store, d.i.root, d.absPath()); err != nil {
 			return err
 		}
-	} else {
-		log.Debugf("Skipping unchanged info: %+v", info)
 	}
 
 	return nil
@@ -208,14 +383,129 @@ func (t *createThumbnail) String() string {
 
 func (t *createThumbnail) Process(ctx context.Context) error {
 	parent, base := filepath.Split(t.absPath)
-	thumbPath := filepath.Join(parent, fmt.Sprintf(".%s.webp", base))
-	err := thumbnail.Create(ctx, t.absPath, thumbPath)
+	thumbPath, err := t.i.artifacts.WritePath(ThumbnailPath(t.absPath))
+	if err != nil {
+		return err
+	}
+	info, err := t.i.store.ReadInfo(parent, false)
+	if err != nil {
+		return err
+	}
+	timeCode, err := thumbnail.Create(ctx, t.absPath, thumbPath, info.File(base).avoidSpans())
 	if err != nil {
 		return err
 	}
 	// Remove the old jpeg thumbnail if it exists.
-	_ = os.Remove(filepath.Join(parent, fmt.Sprintf(".%s.jpg", base)))
-	return nil
+	_ = os.Remove(legacyThumbnailPath(t.absPath))
+
+	// Record the time code so the thumbnail can be reproduced.
+	seconds := timeCode.Seconds()
+	return t.i.store.Update(parent, false, func(info *InfoType) error {
+		info.File(base).Thumbnail = &seconds
+		return nil
+	})
+}
+
+type probeFile struct {
+	i       *Injester
+	absPath string
+}
+
+func (p *probeFile) String() string {
+	return fmt.Sprintf("<probe %s>", p.absPath)
+}
+
+func (p *probeFile) Process(ctx context.Context) error {
+	result, err := probe.Probe(ctx, p.absPath)
+	if err != nil {
+		return err
+	}
+	parent, base := filepath.Split(p.absPath)
+	intro, outro := chapterRanges(result.Chapters)
+	err = p.i.store.Update(parent, false, func(info *InfoType) error {
+		file := info.File(base)
+		file.Probe = result
+		file.Intro = mergeChapterRange(file.Intro, intro)
+		file.Outro = mergeChapterRange(file.Outro, outro)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return UpdateRuntime(p.i.store, p.i.root, parent)
+}
+
+type createPreview struct {
+	i       *Injester
+	absPath string
+}
+
+func (p *createPreview) String() string {
+	return fmt.Sprintf("<preview %s>", p.absPath)
+}
+
+// PreviewPath returns the sidecar path of the animated preview for a video.
+func PreviewPath(videoPath string) string {
+	parent, base := filepath.Split(videoPath)
+	return filepath.Join(parent, fmt.Sprintf(".%s.preview.webp", base))
+}
+
+func (p *createPreview) Process(ctx context.Context) error {
+	parent, base := filepath.Split(p.absPath)
+	info, err := p.i.store.ReadInfo(parent, false)
+	if err != nil {
+		return err
+	}
+	previewPath, err := p.i.artifacts.WritePath(PreviewPath(p.absPath))
+	if err != nil {
+		return err
+	}
+	return thumbnail.CreatePreview(ctx, p.absPath, previewPath, info.File(base).avoidSpans())
+}
+
+// SubtitlePath returns the sidecar path of the cached WebVTT conversion of the subtitle
+// track with the given ID for a video.
+func SubtitlePath(videoPath, id string) string {
+	parent, base := filepath.Split(videoPath)
+	return filepath.Join(parent, fmt.Sprintf(".%s.sub.%s.vtt", base, id))
+}
+
+type createTrickplay struct {
+	i       *Injester
+	absPath string
+}
+
+func (t *createTrickplay) String() string {
+	return fmt.Sprintf("<trickplay %s>", t.absPath)
+}
+
+// TrickplayDir returns the sidecar directory containing trickplay data for a
+// video.
+func TrickplayDir(videoPath string) string {
+	parent, base := filepath.Split(videoPath)
+	return filepath.Join(parent, fmt.Sprintf(".%s.trickplay", base))
+}
+
+func (t *createTrickplay) Process(ctx context.Context) error {
+	videoInfo, err := os.Stat(t.absPath)
+	if err != nil {
+		return err
+	}
+	existing := t.i.artifacts.Path(TrickplayDir(t.absPath))
+	if indexInfo, err := os.Stat(filepath.Join(existing, thumbnail.TrickplayIndex)); err == nil {
+		if indexInfo.ModTime().After(videoInfo.ModTime()) {
+			return nil // Already up to date.
+		}
+		// The video changed since the last run; start over.
+		if err := os.RemoveAll(existing); err != nil {
+			return err
+		}
+	}
+	outDir, err := t.i.artifacts.WritePath(TrickplayDir(t.absPath))
+	if err != nil {
+		return err
+	}
+	return thumbnail.CreateTrickplay(ctx, t.absPath, outDir, t.i.trickplayInterval)
 }
 
 // Run the injester; this returns if the context is closed, or a fatal error
@@ -0,0 +1,177 @@
+package injest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mook/video-listing/probe"
+	"github.com/mook/video-listing/thumbnail"
+)
+
+// scanUnchanged injests a directory that has not changed since it was last
+// injested, returning the tasks that were queued.
+func scanUnchanged(t *testing.T, i *Injester, directory string) []task {
+	t.Helper()
+	absPath := filepath.Join(i.root, directory)
+	// Having an ID already means injesting doesn't query AniList.
+	info := &InfoType{
+		AniListID:  42,
+		Timestamp:  time.Now().Add(time.Hour),
+		IgnoreHash: i.media.ignoreRules(i.root, absPath).hash,
+	}
+	if err := i.store.WriteInfo(absPath, info); err != nil {
+		t.Fatal(err)
+	}
+	i.pending = nil
+	task := &injestDirectory{i: i, QueueOptions: QueueOptions{Directory: directory}}
+	if err := task.Process(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return i.pending
+}
+
+func TestQueueMissingTrickplay(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	show := filepath.Join(root, "show")
+	if err := os.Mkdir(show, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	video := filepath.Join(show, "01.mkv")
+	if err := os.WriteFile(video, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	i := New(root, Options{TrickplayInterval: 10 * time.Second})
+	count := func(tasks []task) int {
+		n := 0
+		for _, task := range tasks {
+			if trickplay, ok := task.(*createTrickplay); ok && trickplay.absPath == video {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := count(scanUnchanged(t, i, "show")); n != 1 {
+		t.Errorf("expected missing trickplay to be queued once, got %d", n)
+	}
+
+	index := filepath.Join(TrickplayDir(video), thumbnail.TrickplayIndex)
+	if err := os.MkdirAll(filepath.Dir(index), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(index, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(scanUnchanged(t, i, "show")); n != 0 {
+		t.Errorf("expected existing trickplay not to be queued, got %d", n)
+	}
+
+	// The video changed after the trickplay was generated.
+	if err := os.Chtimes(index, time.Time{}, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(scanUnchanged(t, i, "show")); n != 1 {
+		t.Errorf("expected stale trickplay to be queued once, got %d", n)
+	}
+}
+
+func TestQueueMissingPreview(t *testing.T) {
+	testCases := []struct {
+		name string
+		// Whether the preview exists, and if so, whether it predates the video.
+		exists   bool
+		stale    bool
+		expected int
+	}{
+		{"missing", false, false, 1},
+		{"current", true, false, 0},
+		{"stale", true, true, 1},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			show := filepath.Join(root, "show")
+			if err := os.Mkdir(show, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			video := filepath.Join(show, "01.mkv")
+			if err := os.WriteFile(video, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if testCase.exists {
+				if err := os.WriteFile(PreviewPath(video), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if testCase.stale {
+				if err := os.Chtimes(PreviewPath(video), time.Time{}, time.Now().Add(-time.Hour)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			i := New(root, Options{Previews: true})
+			n := 0
+			for _, task := range scanUnchanged(t, i, "show") {
+				if preview, ok := task.(*createPreview); ok && preview.absPath == video {
+					n++
+				}
+			}
+			if n != testCase.expected {
+				t.Errorf("expected preview to be queued %d times, got %d", testCase.expected, n)
+			}
+		})
+	}
+}
+
+func TestQueueMissingProbes(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	show := filepath.Join(root, "show")
+	if err := os.Mkdir(show, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"01.mkv", "02.mkv"} {
+		if err := os.WriteFile(filepath.Join(show, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	i := New(root, Options{})
+	count := func(tasks []task) (probes, intros int) {
+		for _, task := range tasks {
+			switch task.(type) {
+			case *probeFile:
+				probes++
+			case *detectIntros:
+				intros++
+			}
+		}
+		return probes, intros
+	}
+
+	if probes, intros := count(scanUnchanged(t, i, "show")); probes != 2 || intros != 1 {
+		t.Errorf("expected 2 probes and 1 intro detection, got %d and %d", probes, intros)
+	}
+
+	// Once everything has been probed and intros detected, nothing is queued.
+	err := i.store.Update(show, false, func(info *InfoType) error {
+		info.File("01.mkv").Probe = &probe.Result{Duration: 1}
+		info.File("02.mkv").Probe = &probe.Result{Duration: 1}
+		info.IntrosDetected = info.Timestamp
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.pending = nil
+	task := &injestDirectory{i: i, QueueOptions: QueueOptions{Directory: "show"}}
+	if err := task.Process(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if probes, intros := count(i.pending); probes != 0 || intros != 0 {
+		t.Errorf("expected nothing to be queued, got %d probes and %d intro detections", probes, intros)
+	}
+}
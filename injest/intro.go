@@ -0,0 +1,121 @@
+package injest
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/mook/video-listing/intro"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// How much of the start and end of each file to search for the opening and
+	// ending sequences.
+	introSearchLength = 5 * time.Minute
+	// The shortest shared section considered to be an opening or ending.
+	introMinLength = 20 * time.Second
+)
+
+// detectIntros finds the opening and ending sequences of the files in a
+// directory by comparing the audio of neighbouring episodes.  Ranges from
+// chapters are kept as-is.
+type detectIntros struct {
+	i       *Injester
+	absPath string
+}
+
+func (d *detectIntros) String() string {
+	return fmt.Sprintf("<intros %s>", d.absPath)
+}
+
+// introWindow is the fingerprint of a section of a file.
+type introWindow struct {
+	start       time.Duration
+	fingerprint intro.Fingerprint
+}
+
+func (d *detectIntros) Process(ctx context.Context) error {
+	log := logrus.WithField("directory", d.absPath)
+	info, err := d.i.store.ReadInfo(d.absPath, false)
+	if err != nil {
+		return err
+	}
+	if !info.IntrosDetected.Before(info.Timestamp) {
+		return nil // Nothing changed since the last run.
+	}
+	timestamp := info.Timestamp
+
+	var names []string
+	for name, file := range info.Files {
+		if file.Probe != nil && file.Probe.Duration > 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	heads := make([]introWindow, len(names))
+	tails := make([]introWindow, len(names))
+	if len(names) > 1 {
+		for n, name := range names {
+			absPath := filepath.Join(d.absPath, name)
+			duration := time.Duration(info.Files[name].Probe.Duration * float64(time.Second))
+			length := min(introSearchLength, duration/3)
+			heads[n].fingerprint, err = intro.Compute(ctx, absPath, 0, length)
+			if err != nil {
+				log.WithError(err).WithField("file", name).Error("Failed to fingerprint opening")
+			}
+			tails[n].start = duration - length
+			tails[n].fingerprint, err = intro.Compute(ctx, absPath, tails[n].start, length)
+			if err != nil {
+				log.WithError(err).WithField("file", name).Error("Failed to fingerprint ending")
+			}
+		}
+	}
+	intros, outros := matchNeighbours(heads), matchNeighbours(tails)
+
+	// Fingerprinting takes a while; apply the results to the current info.
+	return d.i.store.Update(d.absPath, false, func(info *InfoType) error {
+		for n, name := range names {
+			file := info.File(name)
+			if file.Intro == nil || file.Intro.Source == RangeSourceAudio {
+				file.Intro = intros[n]
+			}
+			if file.Outro == nil || file.Outro.Source == RangeSourceAudio {
+				file.Outro = outros[n]
+			}
+		}
+		info.IntrosDetected = timestamp
+		return nil
+	})
+}
+
+// matchNeighbours finds the longest section each window shares with the
+// windows before or after it, if any.
+func matchNeighbours(windows []introWindow) []*Range {
+	result := make([]*Range, len(windows))
+	update := func(n int, offset, length time.Duration) {
+		if result[n] != nil && length.Seconds() <= result[n].End-result[n].Start {
+			return
+		}
+		start := windows[n].start + offset
+		result[n] = &Range{
+			Start:  start.Seconds(),
+			End:    (start + length).Seconds(),
+			Source: RangeSourceAudio,
+		}
+	}
+	for n := 0; n+1 < len(windows); n++ {
+		if windows[n].fingerprint == nil || windows[n+1].fingerprint == nil {
+			continue
+		}
+		match, ok := intro.FindCommon(windows[n].fingerprint, windows[n+1].fingerprint, introMinLength)
+		if ok {
+			update(n, match.A, match.Length)
+			update(n+1, match.B, match.Length)
+		}
+	}
+	return result
+}
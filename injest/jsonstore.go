@@ -0,0 +1,210 @@
+package injest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// JSONStore saves information about each directory as JSON.  By default, it is
+// kept in `.info.json` files in each directory; if a state directory is
+// configured, it is kept in a tree mirroring the media instead so that the
+// media can be mounted read only.
+type JSONStore struct {
+	// The media root directory.
+	root string
+	// The directory to keep state in; if empty, it's kept with the media.
+	stateDir string
+	// Which files are media.
+	media *MediaTypes
+	locks directoryLocks
+}
+
+// NewJSONStore creates a new JSONStore for the media at root.  If stateDir is
+// empty, information is saved alongside the media.  If media is nil, the
+// default media extensions are used.
+func NewJSONStore(root, stateDir string, media *MediaTypes) (*JSONStore, error) {
+	var err error
+	s := &JSONStore{media: media}
+	if s.root, err = filepath.Abs(root); err != nil {
+		return nil, err
+	}
+	if stateDir != "" {
+		if s.stateDir, err = filepath.Abs(stateDir); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// infoPath returns the path to save information about the given directory.
+func (s *JSONStore) infoPath(directory string) string {
+	if s.stateDir != "" {
+		if path := mirrorPath(s.root, s.stateDir, directory); path != "" {
+			return filepath.Join(path, infoBaseName)
+		}
+	}
+	return filepath.Join(directory, infoBaseName)
+}
+
+// open opens the saved information about a directory.  When using a state
+// directory, information saved alongside the media is used until it is first
+// written.
+func (s *JSONStore) open(directory string) (*os.File, error) {
+	f, err := os.Open(s.infoPath(directory))
+	if errors.Is(err, fs.ErrNotExist) && s.stateDir != "" {
+		f, err = os.Open(filepath.Join(directory, infoBaseName))
+	}
+	return f, err
+}
+
+func (s *JSONStore) ReadInfo(directory string, update bool) (*InfoType, error) {
+	info := newInfo()
+	f, err := s.open(directory)
+	if err == nil {
+		defer f.Close()
+		if err := decodeInfo(f, info); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return refreshInfo(s.root, directory, info, err == nil, update, s.media)
+}
+
+func (s *JSONStore) WriteInfo(directory string, info *InfoType) error {
+	infoPath := s.infoPath(directory)
+	if err := os.MkdirAll(filepath.Dir(infoPath), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(infoPath), infoBaseName)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(info); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), infoPath); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *JSONStore) Update(directory string, refresh bool, fn func(info *InfoType) error) error {
+	return s.locks.update(s, directory, refresh, fn)
+}
+
+// Walk visits each directory with saved information.  With a state directory,
+// that is walked first so that directories which have since been moved or
+// removed from the media are included; then the media is walked for any
+// information still saved alongside it.  This reads every directory.
+func (s *JSONStore) Walk(fn func(directory string, info *InfoType) error) error {
+	if s.stateDir == "" {
+		return s.walkMedia(nil, fn)
+	}
+	visited := make(map[string]bool)
+	err := filepath.WalkDir(s.stateDir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == s.stateDir {
+			return nil // Nothing has been saved yet.
+		} else if err != nil {
+			return err
+		}
+		if entry.IsDir() || entry.Name() != infoBaseName {
+			return nil
+		}
+		rel, err := filepath.Rel(s.stateDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		directory := filepath.Join(s.root, rel)
+		info, err := s.ReadInfo(directory, false)
+		if err != nil {
+			return err
+		}
+		visited[directory] = true
+		return fn(directory, info)
+	})
+	if err != nil {
+		return err
+	}
+	return s.walkMedia(visited, fn)
+}
+
+// walkMedia visits each directory of the media with saved information, other
+// than those already visited.
+func (s *JSONStore) walkMedia(visited map[string]bool, fn func(directory string, info *InfoType) error) error {
+	// The ignore rules of each directory walked, to build on for its children.
+	rules := make(map[string]*ignoreRules)
+	return filepath.WalkDir(s.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path == s.root {
+			rules[path] = s.media.ignoreRules(s.root, path)
+		} else {
+			if strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			parent := rules[filepath.Dir(path)]
+			if parent.ignored(entry.Name(), true) {
+				return filepath.SkipDir
+			}
+			rules[path] = parent.descend(path)
+		}
+		if visited[path] {
+			return nil
+		}
+		f, err := s.open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // Nothing saved for this directory.
+		} else if err != nil {
+			return err
+		}
+		_ = f.Close()
+		info, err := s.ReadInfo(path, false)
+		if err != nil {
+			return err
+		}
+		return fn(path, info)
+	})
+}
+
+func (s *JSONStore) mediaRoot() string {
+	return s.root
+}
+
+// backup copies the saved information files into a tree mirroring the media.
+func (s *JSONStore) backup(backupDir string, directories []string) error {
+	for _, directory := range directories {
+		rel, err := filepath.Rel(s.root, directory)
+		if err != nil {
+			return err
+		}
+		f, err := s.open(directory)
+		if err != nil {
+			return err
+		}
+		err = copyNewFile(filepath.Join(backupDir, rel, infoBaseName), f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
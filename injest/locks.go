@@ -0,0 +1,68 @@
+package injest
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+)
+
+// SkipWrite may be returned by the function passed to Store.Update to leave
+// the saved information unchanged; Update itself then returns nil.
+var SkipWrite = errors.New("skip writing directory info")
+
+// directoryLocks serializes updates to the information about each directory,
+// so that concurrent read-modify-write cycles do not lose changes.  The zero
+// value is ready for use.
+type directoryLocks struct {
+	mu    sync.Mutex
+	locks map[string]*directoryLock
+}
+
+type directoryLock struct {
+	sync.Mutex
+	// The number of callers holding or waiting for the lock.
+	refs int
+}
+
+// lock acquires the lock for a directory, returning a function to release it.
+func (l *directoryLocks) lock(directory string) func() {
+	directory = filepath.Clean(directory)
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*directoryLock)
+	}
+	dirLock, ok := l.locks[directory]
+	if !ok {
+		dirLock = &directoryLock{}
+		l.locks[directory] = dirLock
+	}
+	dirLock.refs++
+	l.mu.Unlock()
+
+	dirLock.Lock()
+	return func() {
+		dirLock.Unlock()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if dirLock.refs--; dirLock.refs == 0 {
+			delete(l.locks, directory)
+		}
+	}
+}
+
+// update implements Store.Update on top of the ReadInfo and WriteInfo methods
+// of the given store.
+func (l *directoryLocks) update(s Store, directory string, refresh bool, fn func(info *InfoType) error) error {
+	defer l.lock(directory)()
+	info, err := s.ReadInfo(directory, refresh)
+	if err != nil {
+		return err
+	}
+	if err := fn(info); err != nil {
+		if errors.Is(err, SkipWrite) {
+			return nil
+		}
+		return err
+	}
+	return s.WriteInfo(directory, info)
+}
@@ -0,0 +1,110 @@
+package injest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mook/video-listing/probe"
+)
+
+// TestConcurrentUpdates hammers one directory with marks, probe results and
+// injests at the same time, and checks that no update is lost.
+func TestConcurrentUpdates(t *testing.T) {
+	const fileCount = 16
+	for _, kind := range []string{"sidecar", "state", "bolt"} {
+		t.Run(kind, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			show := filepath.Join(root, "show")
+			if err := os.Mkdir(show, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for n := range fileCount {
+				name := fmt.Sprintf("%02d.mkv", n)
+				names = append(names, name)
+				if err := os.WriteFile(filepath.Join(show, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			store := newTestStore(t, kind, root)
+			i := New(root, Options{Store: store})
+			i.aniListInterval = 0
+			// Having an ID already means injesting doesn't query AniList.
+			if err := store.WriteInfo(show, &InfoType{AniListID: 42}); err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 3*fileCount+1)
+			for _, name := range names {
+				wg.Go(func() {
+					errs <- store.Update(show, false, func(info *InfoType) error {
+						info.SetSeen(name, true)
+						return nil
+					})
+				})
+				wg.Go(func() {
+					errs <- store.Update(show, false, func(info *InfoType) error {
+						info.File(name).Probe = &probe.Result{Duration: 1}
+						return nil
+					})
+				})
+				wg.Go(func() {
+					errs <- UpdateRuntime(store, root, show)
+				})
+			}
+			wg.Go(func() {
+				for n, name := range names {
+					// Touch a file so that the directory is rewritten.
+					mtime := time.Now().Add(time.Duration(n) * time.Second)
+					if err := os.Chtimes(filepath.Join(show, name), mtime, mtime); err != nil {
+						errs <- err
+						return
+					}
+					task := &injestDirectory{i: i, QueueOptions: QueueOptions{Directory: "show"}}
+					if err := task.Process(context.Background()); err != nil {
+						errs <- err
+						return
+					}
+				}
+				errs <- nil
+			})
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Error(err)
+				}
+			}
+
+			if err := UpdateRuntime(store, root, show); err != nil {
+				t.Fatal(err)
+			}
+			info, err := store.ReadInfo(show, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.AniListID != 42 {
+				t.Errorf("lost AniList ID: got %d", info.AniListID)
+			}
+			for _, name := range names {
+				if !info.Seen[name] {
+					t.Errorf("lost mark on %s", name)
+				}
+				if file := info.Files[name]; file == nil || file.Probe == nil {
+					t.Errorf("lost probe result for %s", name)
+				}
+			}
+			expected := Runtime{Total: fileCount, Watched: fileCount}
+			if info.Runtime != expected {
+				t.Errorf("expected runtime %+v, got %+v", expected, info.Runtime)
+			}
+		})
+	}
+}
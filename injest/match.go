@@ -0,0 +1,109 @@
+package injest
+
+import (
+	"strings"
+	"unicode"
+)
+
+// The minimum score for a search result to be accepted without review.
+const matchThreshold = 0.5
+
+// MatchReview describes an AniList search result that did not resemble the
+// directory name closely enough to be accepted automatically.
+type MatchReview struct {
+	// The string AniList was searched with.
+	Search string `json:"search"`
+	// The AniList ID of the best result.
+	ID int `json:"id"`
+	// The title of the best result.
+	Title string `json:"title"`
+	// How similar the best result is to the search, from zero to one.
+	Score float64 `json:"score"`
+}
+
+// bestMatch returns the search result that most resembles the search string,
+// along with its score.  On ties, earlier results win.  There must be at least
+// one result.
+func bestMatch(search string, results []aniListResponseMedia) (aniListResponseMedia, float64) {
+	best, bestScore := results[0], -1.0
+	for _, media := range results {
+		titles := append([]string{media.Title.Romaji, media.Title.English, media.Title.Native}, media.Synonyms...)
+		for _, title := range titles {
+			if title == "" {
+				continue
+			}
+			if score := similarity(search, title); score > bestScore {
+				best, bestScore = media, score
+			}
+		}
+	}
+	return best, max(bestScore, 0)
+}
+
+// normalizeTitle lower cases a title, folds full width characters, and replaces
+// any punctuation with single spaces.
+func normalizeTitle(title string) string {
+	var builder strings.Builder
+	space := true
+	for _, r := range title {
+		if r >= '！' && r <= '～' {
+			r -= '！' - '!'
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			builder.WriteRune(unicode.ToLower(r))
+			space = false
+		} else if !space {
+			builder.WriteRune(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(builder.String())
+}
+
+// similarity scores how closely two titles resemble each other, from zero (not
+// at all) to one (identical after normalization).  This is the average of the
+// edit distance ratio and the fraction of words in the search that prefix a
+// word in the title.
+func similarity(search, title string) float64 {
+	a, b := []rune(normalizeTitle(search)), []rune(normalizeTitle(title))
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	editRatio := 1 - float64(editDistance(a, b))/float64(max(len(a), len(b)))
+
+	searchWords := strings.Fields(string(a))
+	titleWords := strings.Fields(string(b))
+	found := 0
+	for _, word := range searchWords {
+		for _, candidate := range titleWords {
+			if strings.HasPrefix(candidate, word) {
+				found++
+				break
+			}
+		}
+	}
+	wordRatio := float64(found) / float64(len(searchWords))
+
+	return (editRatio + wordRatio) / 2
+}
+
+// editDistance calculates the Levenshtein distance between two strings.
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := range a {
+		current[0] = i + 1
+		for j := range b {
+			cost := 1
+			if a[i] == b[j] {
+				cost = 0
+			}
+			current[j+1] = min(previous[j+1]+1, current[j]+1, previous[j]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
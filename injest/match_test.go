@@ -0,0 +1,53 @@
+package injest
+
+import (
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	testCases := []struct {
+		search string
+		title  string
+		min    float64
+		max    float64
+	}{
+		{"Attack on Titan", "Attack on Titan", 1, 1},
+		{"attack on titan", "Attack on Titan!", 1, 1},
+		{"ＳＨＯＷ", "show", 1, 1},
+		{"Show 2", "Show 2nd Season", matchThreshold, 1},
+		{"Kaguya-sama", "Kaguya-sama: Love is War", matchThreshold, 1},
+		{"Attack on Titan", "Cowboy Bebop", 0, matchThreshold},
+		{"Extras", "Tsuki ga Kirei", 0, matchThreshold},
+		{"", "Anything", 0, 0},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.search+"/"+testCase.title, func(t *testing.T) {
+			t.Parallel()
+			actual := similarity(testCase.search, testCase.title)
+			if actual < testCase.min || actual > testCase.max {
+				t.Errorf("expected score in [%f, %f], got %f", testCase.min, testCase.max, actual)
+			}
+		})
+	}
+}
+
+func TestBestMatch(t *testing.T) {
+	results := make([]aniListResponseMedia, 3)
+	results[0].Id = 1
+	results[0].Title.Romaji = "Shingeki no Kyojin: Kuinaki Sentaku"
+	results[1].Id = 2
+	results[1].Title.Romaji = "Shingeki no Kyojin"
+	results[1].Title.English = "Attack on Titan"
+	results[2].Id = 3
+	results[2].Title.Romaji = "Something Else"
+	results[2].Synonyms = []string{"AoT"}
+
+	media, score := bestMatch("Attack on Titan", results)
+	if media.Id != 2 || score != 1 {
+		t.Errorf("expected exact match on English title, got %d (%f)", media.Id, score)
+	}
+	media, _ = bestMatch("AoT", results)
+	if media.Id != 3 {
+		t.Errorf("expected match on synonym, got %d", media.Id)
+	}
+}
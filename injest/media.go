@@ -0,0 +1,239 @@
+package injest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mook/video-listing/internal/atomicfile"
+	"github.com/mook/video-listing/probe"
+	"github.com/sirupsen/logrus"
+)
+
+// MediaTypesBaseName is the default file name of the cache of probed files.
+const MediaTypesBaseName = ".mediatypes.json"
+
+// The extensions of files that are media by default.
+var defaultMediaExtensions = []string{
+	".3gp", ".asf", ".avi", ".divx", ".f4v", ".flv", ".m2ts", ".m4v", ".mkv",
+	".mov", ".mp4", ".mpg", ".mts", ".ogv", ".rm", ".rmvb", ".ts", ".webm",
+	".wmv",
+}
+
+// The extensions of files that are never probed, as they are known not to be
+// media (or at least, not the kind we list).
+var unprobedExtensions = []string{
+	".ass", ".ssa", ".srt", ".sub", ".idx", ".vtt", // Subtitles
+	".bmp", ".gif", ".jpeg", ".jpg", ".png", ".webp", // Images
+	".flac", ".m4a", ".mka", ".mp3", ".ogg", ".opus", ".wav", // Audio
+	".json", ".md", ".nfo", ".txt", ".xml", // Text
+	".7z", ".rar", ".zip", // Archives
+}
+
+// The minimum duration of probed files to count as media, so that still images
+// with the wrong extension aren't listed.
+const minProbedDuration = time.Second
+
+// MediaOptions configures which files are media.
+type MediaOptions struct {
+	// Extensions of files to treat as media, in addition to the defaults.
+	Extensions []string
+	// Extensions of files to never treat as media, even if they are by default.
+	Excluded []string
+	// Whether to probe files with unknown extensions to check if they are
+	// media.
+	Probe bool
+	// Where to save the results of probing; if empty, they are only kept in
+	// memory.
+	ProbeCache string
+	// Patterns of files and directories to ignore everywhere, in addition to
+	// those in ignore files; see DefaultIgnore.
+	Ignore []string
+}
+
+// probeResult is the cached result of probing a file; it is reused as long as
+// the file is unchanged.
+type probeResult struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Media   bool      `json:"media"`
+}
+
+// MediaTypes decides which files are media, and which files and directories
+// are ignored.  A nil MediaTypes uses the default extensions, without probing,
+// and ignores DefaultIgnore.
+type MediaTypes struct {
+	// Whether each (lower case) extension is media; missing extensions are
+	// unknown.
+	extensions map[string]bool
+	probe      bool
+	cachePath  string
+	// The function to probe files with; this is replaced in tests.
+	prober func(ctx context.Context, path string) (*probe.Result, error)
+	// Global ignore patterns.
+	ignore []string
+
+	mu sync.Mutex
+	// Probe results, keyed by absolute path.
+	cache map[string]probeResult
+	// Whether there are probe results that haven't been saved.
+	dirty bool
+}
+
+// defaultMediaTypes is used when nothing is configured.
+var defaultMediaTypes, _ = NewMediaTypes(MediaOptions{Ignore: DefaultIgnore})
+
+// normalizeExtension returns an extension in lower case with a leading dot.
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// NewMediaTypes creates a new MediaTypes, loading any saved probe results.
+func NewMediaTypes(opts MediaOptions) (*MediaTypes, error) {
+	m := &MediaTypes{
+		extensions: make(map[string]bool),
+		probe:      opts.Probe,
+		cachePath:  opts.ProbeCache,
+		prober:     probe.Probe,
+		cache:      make(map[string]probeResult),
+		ignore:     opts.Ignore,
+	}
+	for _, ext := range unprobedExtensions {
+		m.extensions[ext] = false
+	}
+	for _, ext := range defaultMediaExtensions {
+		m.extensions[ext] = true
+	}
+	for _, ext := range opts.Extensions {
+		if ext = normalizeExtension(ext); ext != "" {
+			m.extensions[ext] = true
+		}
+	}
+	for _, ext := range opts.Excluded {
+		if ext = normalizeExtension(ext); ext != "" {
+			m.extensions[ext] = false
+		}
+	}
+	if m.probe && m.cachePath != "" {
+		data, err := os.ReadFile(m.cachePath)
+		if err == nil {
+			err = json.Unmarshal(data, &m.cache)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		// Forget files that no longer exist.
+		for path := range m.cache {
+			if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+				delete(m.cache, path)
+				m.dirty = true
+			}
+		}
+	}
+	return m, nil
+}
+
+// IsMedia checks if a regular file, given as an absolute path with its
+// directory entry, is a media file.  Files with unknown extensions are only
+// media once probing (when injesting) has found them to be; this never probes,
+// so that listing directories isn't held up.
+func (m *MediaTypes) IsMedia(path string, entry fs.DirEntry) bool {
+	if m == nil {
+		m = defaultMediaTypes
+	}
+	if media, ok := m.extensions[strings.ToLower(filepath.Ext(path))]; ok || !m.probe {
+		return media
+	}
+	stat, err := entry.Info()
+	if err != nil {
+		return false
+	}
+	result, ok := m.cached(path, stat)
+	return ok && result.Media
+}
+
+// cached returns the probe result of a file, if it was probed and is unchanged
+// since.
+func (m *MediaTypes) cached(path string, stat fs.FileInfo) (probeResult, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result, ok := m.cache[path]
+	if !ok || result.Size != stat.Size() || !result.ModTime.Equal(stat.ModTime()) {
+		return probeResult{}, false
+	}
+	return result, true
+}
+
+// probeMedia is like IsMedia, but probes files with unknown extensions that
+// haven't been probed yet.  New results are only saved by saveProbes.
+func (m *MediaTypes) probeMedia(ctx context.Context, path string, entry fs.DirEntry) bool {
+	if m == nil {
+		m = defaultMediaTypes
+	}
+	if media, ok := m.extensions[strings.ToLower(filepath.Ext(path))]; ok || !m.probe {
+		return media
+	}
+	stat, err := entry.Info()
+	if err != nil {
+		return false
+	}
+	if result, ok := m.cached(path, stat); ok {
+		return result.Media
+	}
+
+	log := logrus.WithField("path", path)
+	probeCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	result := probeResult{Size: stat.Size(), ModTime: stat.ModTime()}
+	if probed, err := m.prober(probeCtx, path); err != nil {
+		if ctx.Err() != nil {
+			return false // Shutting down; try again next time.
+		}
+		log.WithError(err).Debug("Failed to probe file; assuming it is not media")
+	} else {
+		duration := time.Duration(probed.Duration * float64(time.Second))
+		result.Media = probed.Video != nil && duration >= minProbedDuration
+	}
+	log.WithField("media", result.Media).Debug("Probed file with unknown extension")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cache[path] = result
+	m.dirty = true
+	return result.Media
+}
+
+// saveProbes writes the probe results to the cache file, if there are new
+// ones.
+func (m *MediaTypes) saveProbes() error {
+	if m == nil || m.cachePath == "" {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirty {
+		return nil
+	}
+	data, err := json.Marshal(m.cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.cachePath), 0o755); err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(m.cachePath, data); err != nil {
+		return err
+	}
+	m.dirty = false
+	return nil
+}
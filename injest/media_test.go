@@ -0,0 +1,172 @@
+package injest
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mook/video-listing/probe"
+)
+
+// dirEntry returns the directory entry of the named file in a directory.
+func dirEntry(t *testing.T, directory, name string) fs.DirEntry {
+	t.Helper()
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == name {
+			return entry
+		}
+	}
+	t.Fatalf("file %s not found", name)
+	return nil
+}
+
+// isMedia checks if the named file in a directory is media.
+func isMedia(t *testing.T, m *MediaTypes, directory, name string) bool {
+	t.Helper()
+	return m.IsMedia(filepath.Join(directory, name), dirEntry(t, directory, name))
+}
+
+// probeMedia checks if the named file in a directory is media, probing it if
+// necessary.
+func probeMedia(t *testing.T, m *MediaTypes, directory, name string) bool {
+	t.Helper()
+	return m.probeMedia(context.Background(), filepath.Join(directory, name), dirEntry(t, directory, name))
+}
+
+func TestMediaExtensions(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"a.mkv", "b.MP4", "c.ts", "d.txt", "e.iso", "f.wmv", "g"} {
+		if err := os.WriteFile(filepath.Join(directory, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configured, err := NewMediaTypes(MediaOptions{
+		Extensions: []string{"ISO", ".txt"},
+		Excluded:   []string{"wmv"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name     string
+		media    *MediaTypes
+		expected map[string]bool
+	}{
+		{"default", nil, map[string]bool{
+			"a.mkv": true, "b.MP4": true, "c.ts": true, "d.txt": false,
+			"e.iso": false, "f.wmv": true, "g": false,
+		}},
+		{"configured", configured, map[string]bool{
+			"a.mkv": true, "b.MP4": true, "c.ts": true, "d.txt": true,
+			"e.iso": true, "f.wmv": false, "g": false,
+		}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			for name, expected := range testCase.expected {
+				if actual := isMedia(t, testCase.media, directory, name); actual != expected {
+					t.Errorf("%s: expected %v, got %v", name, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestMediaProbe(t *testing.T) {
+	t.Parallel()
+	directory := t.TempDir()
+	files := map[string]*probe.Result{
+		"video":     {Duration: 1425, Video: &probe.Video{Codec: "h264"}},
+		"image.bin": {Duration: 0.04, Video: &probe.Video{Codec: "mjpeg"}},
+		"audio.bin": {Duration: 180},
+		"broken":    nil,
+		"cover.jpg": {Duration: 1425, Video: &probe.Video{Codec: "h264"}},
+	}
+	for name := range files {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	probed := make(map[string]int)
+	prober := func(ctx context.Context, path string) (*probe.Result, error) {
+		name := filepath.Base(path)
+		probed[name]++
+		if files[name] == nil {
+			return nil, errors.New("invalid data")
+		}
+		return files[name], nil
+	}
+	cachePath := filepath.Join(t.TempDir(), MediaTypesBaseName)
+	newMediaTypes := func() *MediaTypes {
+		m, err := NewMediaTypes(MediaOptions{Probe: true, ProbeCache: cachePath})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.prober = prober
+		return m
+	}
+	expected := map[string]bool{
+		"video":     true,
+		"image.bin": false,
+		"audio.bin": false,
+		"broken":    false,
+		"cover.jpg": false,
+	}
+	check := func(m *MediaTypes, expectedProbes int) {
+		t.Helper()
+		for name, media := range expected {
+			if actual := probeMedia(t, m, directory, name); actual != media {
+				t.Errorf("%s: expected %v, got %v", name, media, actual)
+			}
+			if actual := isMedia(t, m, directory, name); actual != media {
+				t.Errorf("%s: expected cached %v, got %v", name, media, actual)
+			}
+		}
+		for name, count := range probed {
+			if count != expectedProbes {
+				t.Errorf("%s: expected %d probes, got %d", name, expectedProbes, count)
+			}
+		}
+	}
+
+	m := newMediaTypes()
+	// Only injesting probes files; until then, they aren't media.
+	if isMedia(t, m, directory, "video") || len(probed) > 0 {
+		t.Errorf("unprobed file is media, or was probed: %v", probed)
+	}
+	check(m, 1)
+	if _, ok := probed["cover.jpg"]; ok {
+		t.Error("known extensions should not be probed")
+	}
+	// Results are cached in memory, and in the cache file once saved.
+	check(m, 1)
+	if _, err := os.Stat(cachePath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("cache file was written before saving: %v", err)
+	}
+	if err := m.saveProbes(); err != nil {
+		t.Fatal(err)
+	}
+	check(newMediaTypes(), 1)
+
+	// Changed files are probed again.
+	if err := os.WriteFile(filepath.Join(directory, "video"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if isMedia(t, m, directory, "video") {
+		t.Error("changed video is still media before probing")
+	}
+	if !probeMedia(t, m, directory, "video") {
+		t.Error("changed video is no longer media")
+	}
+	if probed["video"] != 2 {
+		t.Errorf("expected changed file to be probed again, got %d probes", probed["video"])
+	}
+}
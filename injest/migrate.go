@@ -0,0 +1,201 @@
+package injest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Versions of the format of saved information.
+const (
+	// Nothing was saved, but `.<name>.seen` marker files may exist.
+	versionSeenMarkers = 0
+	// Saved before the format was versioned; titles may be in separate
+	// fields per language rather than in Titles.
+	versionUnversioned = 1
+	// InfoVersion is the current version of the format.
+	InfoVersion = 2
+)
+
+// migrations upgrade saved information from each version to the next, in
+// order: migrations[n] upgrades from version n.  The directory is the absolute
+// path of the directory the information is about.
+var migrations = []func(directory string, info *InfoType) error{
+	versionSeenMarkers: migrateSeenMarkers,
+	versionUnversioned: migrateLegacyTitles,
+}
+
+// migrateInfo upgrades information to the current version.
+func migrateInfo(directory string, info *InfoType) error {
+	if info.Version > InfoVersion {
+		return fmt.Errorf("info for %s has version %d, newer than supported version %d",
+			directory, info.Version, InfoVersion)
+	}
+	for info.Version < InfoVersion {
+		if err := migrations[info.Version](directory, info); err != nil {
+			return fmt.Errorf("failed to migrate info for %s from version %d: %w", directory, info.Version, err)
+		}
+		info.Version++
+		info.migrated = true
+		info.changed = true
+	}
+	return nil
+}
+
+// migrateSeenMarkers imports the marker files that were created for each seen
+// media file before information was saved.  Markers for files that are not
+// media are dropped when the directory is listed.
+func migrateSeenMarkers(directory string, info *InfoType) error {
+	markers, err := seenMarkers(directory)
+	if err != nil {
+		return err
+	}
+	for _, marker := range markers {
+		info.Seen[marker[1:len(marker)-5]] = true
+	}
+	return nil
+}
+
+// seenMarkers returns the names of the `.<name>.seen` marker files in a
+// directory.
+func seenMarkers(directory string) ([]string, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	var markers []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if len(name) > 6 && strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".seen") {
+			markers = append(markers, name)
+		}
+	}
+	return markers, nil
+}
+
+// migrateLegacyTitles moves titles from the old per-language fields.
+func migrateLegacyTitles(directory string, info *InfoType) error {
+	info.AddTitle(LangChinese, info.ChineseTitle)
+	info.AddTitle(LangEnglish, info.EnglishTitle)
+	info.AddTitle(LangJapanese, info.NativeTitle)
+	info.legacyTitles = legacyTitles{}
+	return nil
+}
+
+// backuper is implemented by stores that can back up saved information before
+// it is migrated.
+type backuper interface {
+	// mediaRoot returns the root directory of the media the store is about.
+	mediaRoot() string
+	// backup copies the saved information about the given directories into
+	// backupDir, without overwriting any existing backups.
+	backup(backupDir string, directories []string) error
+}
+
+// MigrateStore rewrites all saved information that is in an older format, after
+// backing up the originals into backupDir.  Directories with nothing saved but
+// seen markers are migrated too, after backing up the markers.  This returns the
+// directories that were migrated.
+func MigrateStore(store Store, backupDir string) ([]string, error) {
+	b, ok := store.(backuper)
+	if !ok {
+		return nil, errors.New("store does not support backups")
+	}
+	saved := make(map[string]bool)
+	var directories []string
+	err := store.Walk(func(directory string, info *InfoType) error {
+		saved[directory] = true
+		if info.migrated {
+			directories = append(directories, directory)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	markers := make(map[string][]string)
+	err = filepath.WalkDir(b.mediaRoot(), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() || saved[path] {
+			return nil
+		}
+		if path != b.mediaRoot() && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if markers[path], err = seenMarkers(path); err != nil {
+			return err
+		}
+		if len(markers[path]) < 1 {
+			delete(markers, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(directories) > 0 {
+		if err := b.backup(backupDir, directories); err != nil {
+			return nil, fmt.Errorf("failed to back up: %w", err)
+		}
+	}
+	for _, directory := range slices.Sorted(maps.Keys(markers)) {
+		if err := backupSeenMarkers(b.mediaRoot(), backupDir, directory, markers[directory]); err != nil {
+			return nil, fmt.Errorf("failed to back up: %w", err)
+		}
+		directories = append(directories, directory)
+	}
+	for _, directory := range directories {
+		err := store.Update(directory, false, func(*InfoType) error {
+			return nil // Reading already migrated it.
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return directories, nil
+}
+
+// backupSeenMarkers copies the given seen markers in a directory into a tree
+// mirroring the media in backupDir.
+func backupSeenMarkers(root, backupDir, directory string, markers []string) error {
+	rel, err := filepath.Rel(root, directory)
+	if err != nil {
+		return err
+	}
+	for _, marker := range markers {
+		f, err := os.Open(filepath.Join(directory, marker))
+		if err != nil {
+			return err
+		}
+		err = copyNewFile(filepath.Join(backupDir, rel, marker), f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyNewFile copies data to a new file, failing if it already exists.
+func copyNewFile(dest string, src io.WriterTo) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := src.WriteTo(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,204 @@
+package injest
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// copyFixtures copies the migration fixtures into a new media root.
+func copyFixtures(t *testing.T) string {
+	root := t.TempDir()
+	if err := os.CopyFS(root, os.DirFS(filepath.Join("testdata", "migrate"))); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestMigrations(t *testing.T) {
+	if len(migrations) != InfoVersion {
+		t.Errorf("expected %d migrations, got %d", InfoVersion, len(migrations))
+	}
+}
+
+func TestMigrateFixtures(t *testing.T) {
+	testCases := []struct {
+		// The fixture directory in testdata/migrate.
+		name     string
+		migrated bool
+		seen     map[string]bool
+		titled   bool
+	}{
+		{"seen-markers", true, map[string]bool{"01.mkv": true, "02.mkv": false}, false},
+		{"unversioned-legacy-titles", true, map[string]bool{"01.mkv": true, "02.mkv": false}, true},
+		{"unversioned", true, map[string]bool{"01.mkv": true, "02.mkv": false}, true},
+		{"current", false, map[string]bool{"01.mkv": true, "02.mkv": false}, true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			root := copyFixtures(t)
+			store := newTestStore(t, "sidecar", root)
+			info, err := store.ReadInfo(filepath.Join(root, testCase.name), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Version != InfoVersion {
+				t.Errorf("expected version %d, got %d", InfoVersion, info.Version)
+			}
+			if info.migrated != testCase.migrated {
+				t.Errorf("expected migrated %v, got %v", testCase.migrated, info.migrated)
+			}
+			if !maps.Equal(info.Seen, testCase.seen) {
+				t.Errorf("expected seen %v, got %v", testCase.seen, info.Seen)
+			}
+			if testCase.titled {
+				expected := map[string]string{
+					LangEnglish:  "English Title",
+					LangJapanese: "ネイティブ",
+					LangChinese:  "中文標題",
+				}
+				for lang, title := range expected {
+					if actual := info.Title(lang); actual != title {
+						t.Errorf("expected %s title %q, got %q", lang, title, actual)
+					}
+				}
+				if info.legacyTitles != (legacyTitles{}) {
+					t.Errorf("legacy titles were not cleared: %+v", info.legacyTitles)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	data := []byte(`{"version": 999}`)
+	if err := os.WriteFile(filepath.Join(root, infoBaseName), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store := newTestStore(t, "sidecar", root)
+	if _, err := store.ReadInfo(root, false); err == nil {
+		t.Error("expected an error reading info from a newer version")
+	}
+}
+
+func TestMigrateStore(t *testing.T) {
+	t.Run("sidecar", func(t *testing.T) {
+		t.Parallel()
+		root := copyFixtures(t)
+		store := newTestStore(t, "sidecar", root)
+		backupDir := t.TempDir()
+		directories, err := MigrateStore(store, backupDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The files that were backed up for each directory.
+		backups := map[string][]string{
+			"seen-markers":              {".01.mkv.seen", ".notes.txt.seen"},
+			"unversioned":               {infoBaseName},
+			"unversioned-legacy-titles": {infoBaseName},
+		}
+		names := slices.Sorted(maps.Keys(backups))
+		var actual []string
+		for _, directory := range directories {
+			actual = append(actual, filepath.Base(directory))
+		}
+		slices.Sort(actual)
+		if !slices.Equal(actual, names) {
+			t.Errorf("expected %v to be migrated, got %v", names, actual)
+		}
+
+		for _, name := range names {
+			for _, file := range backups[name] {
+				original, err := os.ReadFile(filepath.Join("testdata", "migrate", name, file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				backup, err := os.ReadFile(filepath.Join(backupDir, name, file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(original, backup) {
+					t.Errorf("%s: backup of %s differs from the original", name, file)
+				}
+			}
+			data, err := os.ReadFile(filepath.Join(root, name, infoBaseName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var saved map[string]any
+			if err := json.Unmarshal(data, &saved); err != nil {
+				t.Fatal(err)
+			}
+			if saved["version"] != float64(InfoVersion) {
+				t.Errorf("%s: expected version %d, got %v", name, InfoVersion, saved["version"])
+			}
+			if _, ok := saved["native"]; ok {
+				t.Errorf("%s: legacy titles were saved: %s", name, data)
+			}
+			if seen, _ := saved["seen"].(map[string]any); seen["01.mkv"] != true {
+				t.Errorf("%s: seen state was not saved: %s", name, data)
+			}
+		}
+
+		// Everything is current now; existing backups are not overwritten.
+		if directories, err = MigrateStore(store, backupDir); err != nil {
+			t.Fatal(err)
+		}
+		if len(directories) > 0 {
+			t.Errorf("expected nothing to migrate, got %v", directories)
+		}
+	})
+
+	t.Run("bolt", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+		store := newTestStore(t, "bolt", root)
+		// Information without a version was saved before versioning.
+		if err := store.WriteInfo(root, &InfoType{legacyTitles: legacyTitles{EnglishTitle: "Title"}}); err != nil {
+			t.Fatal(err)
+		}
+		// Seen markers are kept with the media, outside the database.
+		show := filepath.Join(root, "show")
+		if err := os.Mkdir(show, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"01.mkv", ".01.mkv.seen"} {
+			if err := os.WriteFile(filepath.Join(show, name), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		backupDir := t.TempDir()
+		directories, err := MigrateStore(store, backupDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(directories, []string{root, show}) {
+			t.Errorf("expected %s and %s to be migrated, got %v", root, show, directories)
+		}
+		if _, err := os.Stat(filepath.Join(backupDir, "state.db")); err != nil {
+			t.Errorf("database was not backed up: %s", err)
+		}
+		if _, err := os.Stat(filepath.Join(backupDir, "show", ".01.mkv.seen")); err != nil {
+			t.Errorf("seen marker was not backed up: %s", err)
+		}
+		if info, err := store.ReadInfo(show, false); err != nil {
+			t.Fatal(err)
+		} else if info.migrated || !info.Seen["01.mkv"] {
+			t.Errorf("unexpected info after migrating markers: %+v", info)
+		}
+		info, err := store.ReadInfo(root, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.migrated || info.Title(LangEnglish) != "Title" {
+			t.Errorf("unexpected info after migration: %+v", info)
+		}
+	})
+}
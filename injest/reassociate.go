@@ -0,0 +1,337 @@
+package injest
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mook/video-listing/thumbnail"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// The amount of data hashed from each end of a file to fingerprint it.
+	fingerprintChunkSize = 64 * 1024
+	// How long to remember the state of removed files.
+	orphanRetention = 90 * 24 * time.Hour
+)
+
+// Orphan is the saved state of a media file that was removed.
+type Orphan struct {
+	Seen    bool      `json:"seen,omitempty"`
+	File    *FileInfo `json:"file"`
+	Removed time.Time `json:"removed"`
+}
+
+// Reassociation records a media file found to have been renamed or moved.
+type Reassociation struct {
+	// The old and new paths of the file, relative to the media root.
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Time time.Time `json:"time"`
+}
+
+// fingerprintFile identifies the contents of a file by its size and hashes of
+// its start and end, which is enough to tell media files apart without reading
+// all of them.
+func fingerprintFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.CopyN(hash, f, min(stat.Size(), fingerprintChunkSize)); err != nil {
+		return "", err
+	}
+	if stat.Size() > fingerprintChunkSize {
+		offset := max(stat.Size()-fingerprintChunkSize, fingerprintChunkSize)
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(hash, f); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%d-%x", stat.Size(), hash.Sum(nil)[:16]), nil
+}
+
+// orphanSource is where an orphaned file was found.
+type orphanSource struct {
+	directory string
+	name      string
+	orphan    *Orphan
+}
+
+// trackFiles fingerprints the media files in a directory, and restores the state
+// of any new files that match files removed from elsewhere in the library.
+type trackFiles struct {
+	i       *Injester
+	absPath string
+}
+
+func (t *trackFiles) String() string {
+	return fmt.Sprintf("<track %s>", t.absPath)
+}
+
+func (t *trackFiles) Process(ctx context.Context) error {
+	log := logrus.WithField("directory", t.absPath)
+	snapshot, err := t.i.store.ReadInfo(t.absPath, true)
+	if err != nil {
+		return err
+	}
+
+	fingerprints := make(map[string]string)
+	for name := range snapshot.Seen {
+		if file := snapshot.Files[name]; file != nil && file.Fingerprint != "" {
+			continue
+		}
+		fingerprint, err := fingerprintFile(filepath.Join(t.absPath, name))
+		if err != nil {
+			log.WithError(err).WithField("file", name).Error("Failed to fingerprint file")
+			continue
+		}
+		fingerprints[name] = fingerprint
+	}
+	if len(fingerprints) < 1 && !snapshot.changed {
+		return nil
+	}
+
+	// Find orphans matching the new files, checking this directory first.
+	matches := make(map[string]orphanSource)
+	for name, fingerprint := range fingerprints {
+		for orphanName, orphan := range snapshot.Orphans {
+			if orphan.File.Fingerprint == fingerprint {
+				matches[name] = orphanSource{t.absPath, orphanName, orphan}
+			}
+		}
+	}
+	if len(matches) < len(fingerprints) {
+		if err := t.findOrphans(fingerprints, matches); err != nil {
+			return err
+		}
+	}
+
+	// Claim orphans found elsewhere before updating this directory, so that
+	// only one directory is locked at a time.
+	for name, source := range matches {
+		if source.directory == t.absPath {
+			continue
+		}
+		if err := t.i.removeOrphan(source); err != nil {
+			log.WithError(err).WithField("file", name).Error("Failed to remove orphan")
+			delete(matches, name)
+		}
+	}
+
+	var moved [][2]string
+	err = t.i.store.Update(t.absPath, true, func(info *InfoType) error {
+		moved = nil
+		for name, fingerprint := range fingerprints {
+			if _, ok := info.Seen[name]; !ok {
+				continue // Removed while fingerprinting.
+			}
+			source, ok := matches[name]
+			if ok && source.directory == t.absPath {
+				// The orphan may have been claimed since the snapshot.
+				_, ok = info.Orphans[source.name]
+				delete(info.Orphans, source.name)
+			}
+			if !ok {
+				info.File(name).Fingerprint = fingerprint
+				continue
+			}
+			oldPath := filepath.Join(source.directory, source.name)
+			newPath := filepath.Join(t.absPath, name)
+			info.Seen[name] = source.orphan.Seen
+			*info.File(name) = *source.orphan.File
+			moved = append(moved, [2]string{oldPath, newPath})
+			from, _ := filepath.Rel(t.i.root, oldPath)
+			to, _ := filepath.Rel(t.i.root, newPath)
+			info.Reassociations = append(info.Reassociations, Reassociation{
+				From: filepath.ToSlash(from),
+				To:   filepath.ToSlash(to),
+				Time: time.Now(),
+			})
+			log.WithField("from", from).WithField("to", to).Info("Reassociated moved file")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for name, fingerprint := range fingerprints {
+		if source, ok := matches[name]; ok {
+			t.i.files.remove(fingerprint, filepath.Join(source.directory, source.name))
+		}
+		t.i.files.add(fingerprint, filepath.Join(t.absPath, name))
+	}
+	for _, paths := range moved {
+		t.i.moveArtifacts(paths[0], paths[1])
+	}
+	if len(moved) > 0 {
+		return UpdateRuntime(t.i.store, t.i.root, t.absPath)
+	}
+	return nil
+}
+
+// findOrphans looks through the whole library for orphans matching the given
+// fingerprints, adding them to matches.  Files that have been removed but not
+// yet noticed (because their directory has not been read since) are also
+// considered orphans.
+func (t *trackFiles) findOrphans(fingerprints map[string]string, matches map[string]orphanSource) error {
+	claimed := make(map[string]bool)
+	for _, source := range matches {
+		claimed[filepath.Join(source.directory, source.name)] = true
+	}
+	for name, fingerprint := range fingerprints {
+		if _, ok := matches[name]; ok {
+			continue
+		}
+		candidates, err := t.i.files.lookup(t.i.store, fingerprint)
+		if err != nil {
+			return err
+		}
+		for _, path := range candidates {
+			directory, oldName := filepath.Split(path)
+			directory = filepath.Clean(directory)
+			if directory == t.absPath || claimed[path] {
+				continue // Already checked, or matched to another file.
+			}
+			info, err := t.i.store.ReadInfo(directory, false)
+			if err != nil {
+				return err
+			}
+			orphan := info.Orphans[oldName]
+			if file := info.Files[oldName]; orphan == nil && file != nil {
+				if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+					orphan = &Orphan{Seen: info.Seen[oldName], File: file}
+				}
+			}
+			if orphan != nil && orphan.File.Fingerprint == fingerprint {
+				matches[name] = orphanSource{directory, oldName, orphan}
+				claimed[path] = true
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// fileIndex locates fingerprinted files (including orphans) throughout the
+// library, so that moved files can be matched without walking the whole store
+// for every directory.  It is built from the store when first needed, and then
+// kept up to date as files are fingerprinted and moved; as files may have
+// changed since, callers must check the entries they find.
+type fileIndex struct {
+	mu    sync.Mutex
+	built bool
+	// Absolute paths of files, by fingerprint.
+	paths map[string][]string
+}
+
+// lookup returns the paths of the files with the given fingerprint.
+func (x *fileIndex) lookup(store Store, fingerprint string) ([]string, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.built {
+		err := store.Walk(func(directory string, info *InfoType) error {
+			for name, file := range info.Files {
+				x.addLocked(file.Fingerprint, filepath.Join(directory, name))
+			}
+			for name, orphan := range info.Orphans {
+				x.addLocked(orphan.File.Fingerprint, filepath.Join(directory, name))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		x.built = true
+	}
+	return slices.Clone(x.paths[fingerprint]), nil
+}
+
+// add records a file with the given fingerprint.
+func (x *fileIndex) add(fingerprint, path string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.addLocked(fingerprint, path)
+}
+
+func (x *fileIndex) addLocked(fingerprint, path string) {
+	if fingerprint == "" || slices.Contains(x.paths[fingerprint], path) {
+		return
+	}
+	if x.paths == nil {
+		x.paths = make(map[string][]string)
+	}
+	x.paths[fingerprint] = append(x.paths[fingerprint], path)
+}
+
+// remove forgets a file with the given fingerprint.
+func (x *fileIndex) remove(fingerprint, path string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.paths[fingerprint] = slices.DeleteFunc(x.paths[fingerprint], func(p string) bool {
+		return p == path
+	})
+	if len(x.paths[fingerprint]) < 1 {
+		delete(x.paths, fingerprint)
+	}
+}
+
+// removeOrphan removes a matched orphan from the directory it was found in.
+func (i *Injester) removeOrphan(source orphanSource) error {
+	err := i.store.Update(source.directory, false, func(info *InfoType) error {
+		delete(info.Orphans, source.name)
+		delete(info.Files, source.name)
+		delete(info.Seen, source.name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return UpdateRuntime(i.store, i.root, source.directory)
+}
+
+// moveArtifacts moves the generated artifacts of a media file that was renamed
+// or moved.  Failures are logged, as the artifacts can be regenerated.
+func (i *Injester) moveArtifacts(oldPath, newPath string) {
+	sidecars := [][2]string{
+		{ThumbnailPath(oldPath), ThumbnailPath(newPath)},
+		{PreviewPath(oldPath), PreviewPath(newPath)},
+		{TrickplayDir(oldPath), TrickplayDir(newPath)},
+	}
+	for _, width := range thumbnail.Widths {
+		sidecars = append(sidecars, [2]string{
+			thumbnail.SizedPath(ThumbnailPath(oldPath), width),
+			thumbnail.SizedPath(ThumbnailPath(newPath), width),
+		})
+	}
+	for _, sidecar := range sidecars {
+		src := i.artifacts.Path(sidecar[0])
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		dest, err := i.artifacts.WritePath(sidecar[1])
+		if err == nil {
+			err = os.Rename(src, dest)
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("path", src).Error("Failed to move artifact")
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package injest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrackFiles(t *testing.T) {
+	root := t.TempDir()
+	show, other := filepath.Join(root, "show"), filepath.Join(root, "other")
+	for _, dir := range []string{show, other} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, size := range map[string]int{"1.mkv": 3 * fingerprintChunkSize, "2.mkv": 100} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(len(name) + i*len(name)*size)
+		}
+		if err := os.WriteFile(filepath.Join(show, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	i := New(root, Options{})
+	track := func(dir string) *InfoType {
+		t.Helper()
+		if err := (&trackFiles{i: i, absPath: dir}).Process(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		info, err := i.store.ReadInfo(dir, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	info := track(show)
+	if info.Files["1.mkv"].Fingerprint == "" || info.Files["1.mkv"].Fingerprint == info.Files["2.mkv"].Fingerprint {
+		t.Fatalf("unexpected fingerprints %+v %+v", info.Files["1.mkv"], info.Files["2.mkv"])
+	}
+	info.Seen["1.mkv"] = true
+	timeCode := 12.5
+	info.Files["1.mkv"].Thumbnail = &timeCode
+	if err := i.store.WriteInfo(show, info); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ThumbnailPath(filepath.Join(show, "1.mkv")), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Move the file to another directory, before the old one is read again.
+	if err := os.Rename(filepath.Join(show, "1.mkv"), filepath.Join(other, "moved.mkv")); err != nil {
+		t.Fatal(err)
+	}
+	info = track(other)
+	if !info.Seen["moved.mkv"] || info.Files["moved.mkv"].Thumbnail == nil {
+		t.Errorf("state did not follow moved file: %+v", info)
+	}
+	if _, err := os.Stat(ThumbnailPath(filepath.Join(other, "moved.mkv"))); err != nil {
+		t.Errorf("thumbnail did not follow moved file: %v", err)
+	}
+	if len(info.Reassociations) != 1 || info.Reassociations[0].From != "show/1.mkv" ||
+		info.Reassociations[0].To != "other/moved.mkv" {
+		t.Errorf("unexpected reassociations %+v", info.Reassociations)
+	}
+	info = track(show)
+	if _, ok := info.Seen["1.mkv"]; ok || len(info.Orphans) > 0 {
+		t.Errorf("moved file still in old directory: %+v", info)
+	}
+
+	// Rename the file within the same directory.
+	if err := os.Rename(filepath.Join(other, "moved.mkv"), filepath.Join(other, "renamed.mkv")); err != nil {
+		t.Fatal(err)
+	}
+	info = track(other)
+	if !info.Seen["renamed.mkv"] || len(info.Orphans) > 0 || len(info.Reassociations) != 2 {
+		t.Errorf("state did not follow renamed file: %+v", info)
+	}
+}
+
+func TestTrackUnchangedDirectory(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	show, other := filepath.Join(root, "show"), filepath.Join(root, "other")
+	for _, dir := range []string{show, other} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(show, "1.mkv"), []byte("video"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	i := New(root, Options{})
+
+	// Scanning a directory that hasn't changed still fingerprints its files.
+	tracked := false
+	for _, task := range scanUnchanged(t, i, "show") {
+		if task, ok := task.(*trackFiles); ok && task.absPath == show {
+			if err := task.Process(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			tracked = true
+		}
+	}
+	if !tracked {
+		t.Fatal("files in unchanged directory were not tracked")
+	}
+	err := i.store.Update(show, true, func(info *InfoType) error {
+		info.Seen["1.mkv"] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Move the file into a directory that has never been scanned.
+	if err := os.Rename(filepath.Join(show, "1.mkv"), filepath.Join(other, "moved.mkv")); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&trackFiles{i: i, absPath: other}).Process(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	info, err := i.store.ReadInfo(other, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Seen["moved.mkv"] || len(info.Reassociations) != 1 {
+		t.Errorf("state did not follow moved file: %+v", info)
+	}
+}
+
+func TestTrackMovedDirectory(t *testing.T) {
+	for _, kind := range []string{"state", "bolt"} {
+		t.Run(kind, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			season := filepath.Join(root, "Show", "Season 1")
+			if err := os.MkdirAll(season, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(season, "01.mkv"), []byte("video"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			store := newTestStore(t, kind, root)
+			i := New(root, Options{Store: store})
+			if err := (&trackFiles{i: i, absPath: season}).Process(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			err := store.Update(season, true, func(info *InfoType) error {
+				info.Seen["01.mkv"] = true
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Move the whole directory; its saved information stays behind, and a
+			// new injester has to find it by walking the store.
+			moved := filepath.Join(root, "Show", "S1")
+			if err := os.Rename(season, moved); err != nil {
+				t.Fatal(err)
+			}
+			i = New(root, Options{Store: store})
+			if err := (&trackFiles{i: i, absPath: moved}).Process(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			info, err := store.ReadInfo(moved, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.Seen["01.mkv"] || len(info.Reassociations) != 1 ||
+				info.Reassociations[0].From != "Show/Season 1/01.mkv" {
+				t.Errorf("state did not follow moved directory: %+v", info)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package injest
+
+import (
+	"path/filepath"
+)
+
+// Runtime aggregates the durations, in seconds, of the media in a directory and
+// all of its children.
+type Runtime struct {
+	Total   float64 `json:"total"`
+	Watched float64 `json:"watched"`
+}
+
+// Remaining returns the duration of the media not yet watched, in seconds.
+func (r Runtime) Remaining() float64 {
+	return r.Total - r.Watched
+}
+
+// calculateRuntime updates the runtime totals of a directory, given as an
+// absolute path, from its own files and the stored totals of its children.
+// This returns whether the totals changed.
+func (info *InfoType) calculateRuntime(s Store, directory string) bool {
+	var runtime Runtime
+	for name, file := range info.Files {
+		if file.Probe == nil {
+			continue
+		}
+		runtime.Total += file.Probe.Duration
+		if info.Seen[name] {
+			runtime.Watched += file.Probe.Duration
+		}
+	}
+	for child := range info.Injested {
+		childInfo, err := s.ReadInfo(filepath.Join(directory, child), false)
+		if err != nil {
+			continue
+		}
+		runtime.Total += childInfo.Runtime.Total
+		runtime.Watched += childInfo.Runtime.Watched
+	}
+	if runtime == info.Runtime {
+		return false
+	}
+	info.Runtime = runtime
+	info.changed = true
+	return true
+}
+
+// UpdateRuntime recalculates the runtime totals of a directory, given as an
+// absolute path under root, and then of each of its ancestors up to the root.
+// This should be called after the durations or seen state of any files in the
+// directory change; ancestors are only rewritten as needed.
+func UpdateRuntime(s Store, root, directory string) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if directory, err = filepath.Abs(directory); err != nil {
+		return err
+	}
+	for {
+		changed := false
+		err := s.Update(directory, false, func(info *InfoType) error {
+			if changed = info.calculateRuntime(s, directory); !changed {
+				return SkipWrite
+			}
+			return nil
+		})
+		if err != nil || !changed {
+			return err
+		}
+		parent := filepath.Dir(directory)
+		if directory == root || parent == directory {
+			return nil
+		}
+		directory = parent
+	}
+}
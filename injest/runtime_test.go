@@ -0,0 +1,63 @@
+package injest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mook/video-listing/probe"
+)
+
+func TestUpdateRuntime(t *testing.T) {
+	for _, name := range []string{"sidecar", "state", "bolt"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			store := newTestStore(t, name, root)
+			show := filepath.Join(root, "show")
+			season := filepath.Join(show, "season")
+			if err := os.MkdirAll(season, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for dir, child := range map[string]string{root: "show", show: "season"} {
+				err := store.WriteInfo(dir, &InfoType{Injested: map[string]time.Time{child: {}}})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := store.WriteInfo(season, &InfoType{
+				Seen: map[string]bool{"1.mkv": true, "2.mkv": false, "3.mkv": false},
+				Files: map[string]*FileInfo{
+					"1.mkv": {Probe: &probe.Result{Duration: 100}},
+					"2.mkv": {Probe: &probe.Result{Duration: 200}},
+					"3.mkv": {}, // Not yet probed
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := UpdateRuntime(store, root, season); err != nil {
+				t.Fatal(err)
+			}
+			expected := Runtime{Total: 300, Watched: 100}
+			for _, dir := range []string{season, show, root} {
+				info, err := store.ReadInfo(dir, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Runtime != expected {
+					t.Errorf("%s: expected %+v, got %+v", dir, expected, info.Runtime)
+				}
+				_, err = os.Stat(filepath.Join(dir, infoBaseName))
+				if (err == nil) != (name == "sidecar") {
+					t.Errorf("%s: unexpected info file state: %v", dir, err)
+				}
+			}
+			if remaining := expected.Remaining(); remaining != 200 {
+				t.Errorf("expected 200 seconds remaining, got %f", remaining)
+			}
+		})
+	}
+}
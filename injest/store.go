@@ -0,0 +1,31 @@
+package injest
+
+// Store reads and writes the saved information about media directories, which
+// are identified by their absolute paths.
+type Store interface {
+	// ReadInfo reads the saved information about a directory.  It is not an
+	// error if nothing was saved.  The Seen and Injested maps are filled to
+	// contain zero values; if update is set, they are refreshed from the
+	// directory listing.
+	ReadInfo(directory string, update bool) (*InfoType, error)
+	// WriteInfo saves the information about a directory.
+	WriteInfo(directory string, info *InfoType) error
+	// Update reads the information about a directory (as ReadInfo), passes
+	// it to fn to modify, and then saves it.  Updates to the same directory
+	// are serialized, so fn should not do anything slow such as network
+	// requests.  If fn returns an error, nothing is saved; SkipWrite may be
+	// returned when nothing changed.
+	Update(directory string, refresh bool, fn func(info *InfoType) error) error
+	// Walk calls fn with the saved information of every directory, in no
+	// particular order, stopping at the first error.
+	Walk(fn func(directory string, info *InfoType) error) error
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// CopyStore copies all saved information from one store into another.
+func CopyStore(dest, src Store) error {
+	return src.Walk(func(directory string, info *InfoType) error {
+		return dest.WriteInfo(directory, info)
+	})
+}
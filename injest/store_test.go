@@ -0,0 +1,90 @@
+package injest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestStore creates a store of the given kind for media at root: "sidecar"
+// and "state" are JSONStores without and with a state directory, and "bolt" is
+// a BoltStore.
+func newTestStore(t *testing.T, kind, root string) Store {
+	var store Store
+	var err error
+	switch kind {
+	case "sidecar":
+		store, err = NewJSONStore(root, "", nil)
+	case "state":
+		store, err = NewJSONStore(root, t.TempDir(), nil)
+	case "bolt":
+		store, err = NewBoltStore(root, filepath.Join(t.TempDir(), "state.db"), nil)
+	default:
+		t.Fatalf("unknown store kind %q", kind)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestStore(t *testing.T) {
+	for _, kind := range []string{"sidecar", "state", "bolt"} {
+		t.Run(kind, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			show := filepath.Join(root, "show")
+			if err := os.Mkdir(show, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"1.mkv", "2.mkv"} {
+				if err := os.WriteFile(filepath.Join(show, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			store := newTestStore(t, kind, root)
+
+			// Nothing saved yet; the files should be listed.
+			info, err := store.ReadInfo(show, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(info.Seen) != 2 {
+				t.Errorf("expected two files, got %+v", info.Seen)
+			}
+			info.Seen["1.mkv"] = true
+			info.AniListID = 42
+			if err := store.WriteInfo(show, info); err != nil {
+				t.Fatal(err)
+			}
+
+			walked := make(map[string]*InfoType)
+			err = store.Walk(func(directory string, info *InfoType) error {
+				walked[directory] = info
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(walked) != 1 || walked[show] == nil {
+				t.Fatalf("unexpected walk results %+v", walked)
+			}
+
+			// Copying into a database should preserve everything.
+			dest := newTestStore(t, "bolt", root)
+			if err := CopyStore(dest, store); err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range []Store{store, dest} {
+				info, err := s.ReadInfo(show, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.AniListID != 42 || !info.Seen["1.mkv"] || info.Seen["2.mkv"] {
+					t.Errorf("unexpected info %+v", info)
+				}
+			}
+		})
+	}
+}
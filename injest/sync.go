@@ -0,0 +1,166 @@
+package injest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const aniListSaveProgress = `
+	mutation ($mediaId: Int!, $progress: Int!, $status: MediaListStatus!) {
+		SaveMediaListEntry(mediaId: $mediaId, progress: $progress, status: $status) {
+			id
+			progress
+			status
+		}
+	}
+`
+const aniListListEntry = `
+	query ($id: Int!) {
+		Media(id: $id, type: ANIME) {
+			episodes
+			mediaListEntry {
+				progress
+				status
+			}
+		}
+	}
+`
+
+type aniListListEntryResponse struct {
+	Media struct {
+		Episodes       int `json:"episodes"`
+		MediaListEntry *struct {
+			Progress int    `json:"progress"`
+			Status   string `json:"status"`
+		} `json:"mediaListEntry"`
+	} `json:"Media"`
+}
+
+// pushProgress is a task to update the user's AniList list with the number of
+// episodes seen in a directory.
+type pushProgress struct {
+	i         *Injester
+	directory string
+}
+
+func (p *pushProgress) String() string {
+	return fmt.Sprintf("<push %s>", p.directory)
+}
+
+func (p *pushProgress) Process(ctx context.Context) error {
+	log := logrus.WithField("directory", p.directory)
+	info, err := p.i.store.ReadInfo(filepath.Join(p.i.root, p.directory), false)
+	if err != nil {
+		return err
+	}
+	if info.AniListID < 1 {
+		log.Debug("Skipping progress push for unknown media")
+		return nil
+	}
+
+	progress := 0
+	for _, seen := range info.Seen {
+		if seen {
+			progress++
+		}
+	}
+	status := "CURRENT"
+	if progress == 0 {
+		status = "PLANNING"
+	} else if info.Episodes > 0 && progress >= info.Episodes {
+		status = "COMPLETED"
+	}
+
+	timeout := time.After(p.i.aniListInterval)
+	defer func() { <-timeout }()
+	var output any
+	err = p.i.queryAniList(ctx, aniListRequest{
+		Query: aniListSaveProgress,
+		Variables: map[string]any{
+			"mediaId":  info.AniListID,
+			"progress": progress,
+			"status":   status,
+		},
+	}, &output)
+	log.WithError(err).WithField("progress", progress).Debug("Pushed progress to AniList")
+	return err
+}
+
+// pullProgress is a task to mark episodes in a directory as seen based on the
+// progress recorded on the user's AniList list.  Child directories are also
+// queued for pulling.
+type pullProgress struct {
+	i         *Injester
+	directory string
+}
+
+func (p *pullProgress) String() string {
+	return fmt.Sprintf("<pull %s>", p.directory)
+}
+
+func (p *pullProgress) Process(ctx context.Context) error {
+	log := logrus.WithField("directory", p.directory)
+	absPath := filepath.Join(p.i.root, p.directory)
+	info, err := p.i.store.ReadInfo(absPath, true)
+	if err != nil {
+		return err
+	}
+
+	for child := range info.Injested {
+		p.i.queue(&pullProgress{i: p.i, directory: filepath.Join(p.directory, child)})
+	}
+
+	if info.AniListID < 1 || len(info.Seen) < 1 {
+		return nil
+	}
+
+	timeout := time.After(p.i.aniListInterval)
+	defer func() { <-timeout }()
+	var output aniListListEntryResponse
+	err = p.i.queryAniList(ctx, aniListRequest{
+		Query:     aniListListEntry,
+		Variables: map[string]any{"id": info.AniListID},
+	}, &output)
+	if err != nil {
+		return err
+	}
+	entry := output.Media.MediaListEntry
+	log.WithField("entry", entry).Debug("Pulled progress from AniList")
+	if entry == nil {
+		return nil
+	}
+
+	// The query may take a while; apply the progress to the current info.
+	changed := false
+	err = p.i.store.Update(absPath, true, func(info *InfoType) error {
+		if output.Media.Episodes > 0 && output.Media.Episodes != info.Episodes {
+			info.Episodes = output.Media.Episodes
+			info.changed = true
+		}
+
+		// We assume the files sort in episode order.
+		files := slices.Sorted(maps.Keys(info.Seen))
+		progress := entry.Progress
+		if entry.Status == "COMPLETED" {
+			progress = len(files)
+		}
+		for _, name := range files[:min(progress, len(files))] {
+			info.SetSeen(name, true)
+		}
+
+		if changed = info.changed; !changed {
+			return SkipWrite
+		}
+		return nil
+	})
+	if err != nil || !changed {
+		return err
+	}
+	return UpdateRuntime(p.i.store, p.i.root, absPath)
+}
@@ -0,0 +1,159 @@
+package injest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAniList is a minimal stand-in for the AniList GraphQL endpoint.  It
+// records received requests, and replies with a fixed list entry or fixed
+// media.
+type fakeAniList struct {
+	t        *testing.T
+	token    string
+	progress int
+	status   string
+	media    []aniListResponseMedia
+	mu       sync.Mutex
+	requests []aniListRequest
+}
+
+func (f *fakeAniList) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != "Bearer "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var input aniListRequest
+	if err := json.NewDecoder(req.Body).Decode(&input); err != nil {
+		f.t.Errorf("failed to decode request: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, input)
+	f.mu.Unlock()
+
+	var data any
+	switch {
+	case strings.Contains(input.Query, "SaveMediaListEntry"):
+		data = map[string]any{"SaveMediaListEntry": input.Variables}
+	case strings.Contains(input.Query, "mediaListEntry"):
+		data = map[string]any{"Media": map[string]any{
+			"episodes": 12,
+			"mediaListEntry": map[string]any{
+				"progress": f.progress,
+				"status":   f.status,
+			},
+		}}
+	case strings.Contains(input.Query, "Page"):
+		data = map[string]any{"Page": map[string]any{"media": f.media}}
+	default:
+		f.t.Errorf("unexpected query %s", input.Query)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+// setupSync creates a media directory with the given files, and an injester
+// talking to a fake AniList server.
+func setupSync(t *testing.T, fake *fakeAniList, seen map[string]bool) (*Injester, string) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "show")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name := range seen {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake.t = t
+	fake.token = "secret"
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	i := New(root, Options{AniListToken: fake.token})
+	i.aniListEndpoint = server.URL
+	i.aniListInterval = 0
+	if err := i.store.WriteInfo(dir, &InfoType{AniListID: 42, Episodes: 2, Seen: seen}); err != nil {
+		t.Fatal(err)
+	}
+	return i, dir
+}
+
+func TestPushProgress(t *testing.T) {
+	testCases := []struct {
+		name     string
+		seen     map[string]bool
+		progress float64
+		status   string
+	}{
+		{"none", map[string]bool{"1.mkv": false, "2.mkv": false}, 0, "PLANNING"},
+		{"some", map[string]bool{"1.mkv": true, "2.mkv": false}, 1, "CURRENT"},
+		{"all", map[string]bool{"1.mkv": true, "2.mkv": true}, 2, "COMPLETED"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			fake := &fakeAniList{}
+			i, _ := setupSync(t, fake, testCase.seen)
+			task := &pushProgress{i: i, directory: "show"}
+			if err := task.Process(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.requests) != 1 {
+				t.Fatalf("expected one request, got %+v", fake.requests)
+			}
+			vars := fake.requests[0].Variables
+			if vars["mediaId"] != float64(42) {
+				t.Errorf("unexpected media ID %v", vars["mediaId"])
+			}
+			if vars["progress"] != testCase.progress {
+				t.Errorf("expected progress %v, got %v", testCase.progress, vars["progress"])
+			}
+			if vars["status"] != testCase.status {
+				t.Errorf("expected status %s, got %v", testCase.status, vars["status"])
+			}
+		})
+	}
+}
+
+func TestPullProgress(t *testing.T) {
+	testCases := []struct {
+		name     string
+		progress int
+		status   string
+		expected map[string]bool
+	}{
+		{"partial", 1, "CURRENT", map[string]bool{"1.mkv": true, "2.mkv": false, "3.mkv": true}},
+		{"completed", 0, "COMPLETED", map[string]bool{"1.mkv": true, "2.mkv": true, "3.mkv": true}},
+		{"keeps local", 0, "CURRENT", map[string]bool{"1.mkv": false, "2.mkv": false, "3.mkv": true}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			fake := &fakeAniList{progress: testCase.progress, status: testCase.status}
+			i, dir := setupSync(t, fake, map[string]bool{"1.mkv": false, "2.mkv": false, "3.mkv": true})
+			task := &pullProgress{i: i, directory: "show"}
+			if err := task.Process(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			info, err := i.store.ReadInfo(dir, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, expected := range testCase.expected {
+				if info.Seen[name] != expected {
+					t.Errorf("expected %s to be %v, got %v", name, expected, info.Seen[name])
+				}
+			}
+			if info.Episodes != 12 {
+				t.Errorf("expected episode count to be updated, got %d", info.Episodes)
+			}
+		})
+	}
+}
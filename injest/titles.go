@@ -0,0 +1,97 @@
+package injest
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Language tags for InfoType.Titles.  These are BCP 47 tags; other tags may
+// also be present.
+const (
+	LangJapanese    = "ja"
+	LangRomaji      = "ja-Latn"
+	LangEnglish     = "en"
+	LangKorean      = "ko"
+	LangChinese     = "zh"
+	LangSimplified  = "zh-Hans"
+	LangTraditional = "zh-Hant"
+	// Titles where the language could not be determined.
+	LangUnknown = "und"
+)
+
+// AddTitle records a title in the given language.  The first title added for a
+// language is its main title; any further ones are synonyms.
+func (info *InfoType) AddTitle(lang, title string) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return
+	}
+	if info.Titles == nil {
+		info.Titles = make(map[string][]string)
+	}
+	if !slices.Contains(info.Titles[lang], title) {
+		info.Titles[lang] = append(info.Titles[lang], title)
+	}
+}
+
+// Title returns the main title in the given language, or an empty string if
+// none is available.  If there is no exact match, a title in the base language
+// (e.g. "zh" for "zh-Hant") or in another variant of the language (e.g.
+// "zh-Hant" for "zh" or "zh-Hans") is returned instead.
+func (info *InfoType) Title(lang string) string {
+	if titles := info.Titles[lang]; len(titles) > 0 {
+		return titles[0]
+	}
+	base, _, hasVariant := strings.Cut(lang, "-")
+	if hasVariant {
+		if titles := info.Titles[base]; len(titles) > 0 {
+			return titles[0]
+		}
+	}
+	var variants []string
+	for tag := range info.Titles {
+		if strings.HasPrefix(tag, base+"-") && tag != lang {
+			variants = append(variants, tag)
+		}
+	}
+	slices.Sort(variants)
+	for _, tag := range variants {
+		if titles := info.Titles[tag]; len(titles) > 0 {
+			return titles[0]
+		}
+	}
+	return ""
+}
+
+// guessLanguage returns a best-effort language tag for a title, based on the
+// scripts it is written in.
+func guessLanguage(title string) string {
+	han := false
+	for _, r := range title {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			return LangJapanese
+		case unicode.Is(unicode.Hangul, r):
+			return LangKorean
+		case unicode.Is(unicode.Han, r):
+			han = true
+		}
+	}
+	if han {
+		return LangChinese
+	}
+	return LangUnknown
+}
+
+// normalizeChineseTag maps the various Chinese language tags used by WikiData
+// to the script-based tags we store.
+func normalizeChineseTag(tag string) string {
+	switch strings.ToLower(tag) {
+	case "zh-hans", "zh-cn", "zh-sg", "zh-my":
+		return LangSimplified
+	case "zh-hant", "zh-tw", "zh-hk", "zh-mo":
+		return LangTraditional
+	}
+	return LangChinese
+}
@@ -0,0 +1,56 @@
+package injest
+
+import (
+	"testing"
+)
+
+func TestTitle(t *testing.T) {
+	info := &InfoType{}
+	info.AddTitle(LangJapanese, "進撃の巨人")
+	info.AddTitle(LangRomaji, "Shingeki no Kyojin")
+	info.AddTitle(LangEnglish, "Attack on Titan")
+	info.AddTitle(LangEnglish, "AoT")
+	info.AddTitle(LangTraditional, "進擊的巨人")
+
+	testCases := []struct {
+		lang     string
+		expected string
+	}{
+		{LangJapanese, "進撃の巨人"},
+		{LangRomaji, "Shingeki no Kyojin"},
+		{LangEnglish, "Attack on Titan"},
+		{"en-US", "Attack on Titan"},
+		{LangChinese, "進擊的巨人"},
+		{LangSimplified, "進擊的巨人"},
+		{LangKorean, ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.lang, func(t *testing.T) {
+			t.Parallel()
+			if actual := info.Title(testCase.lang); actual != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGuessLanguage(t *testing.T) {
+	testCases := []struct {
+		title    string
+		expected string
+	}{
+		{"進撃の巨人", LangJapanese},
+		{"シンゲキ", LangJapanese},
+		{"进击的巨人", LangChinese},
+		{"진격의 거인", LangKorean},
+		{"Attack on Titan", LangUnknown},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			t.Parallel()
+			if actual := guessLanguage(testCase.title); actual != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package injest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+//go:embed transforms.json
+var defaultTitleTransforms []byte
+
+// TitleTransform is a rule for rewriting a directory name into a string to
+// search AniList with.  Rules are applied in order; each rule that matches
+// replaces all matches of its regular expression in the search string.
+type TitleTransform struct {
+	// Free-form description of the rule.
+	Comment string `json:"comment,omitempty"`
+	// Regular expression to match against the search string.
+	Match string `json:"match"`
+	// Template to replace matches with.  Capture groups are referenced as `$1`
+	// or `${name}`; `${parent}` is the search string for the parent directory,
+	// and rules using it don't apply to top level directories.
+	Replace string `json:"replace"`
+	matcher *regexp.Regexp
+}
+
+// LoadTitleTransforms reads title transform rules from a JSON file.  If the
+// path is empty, the default rules are returned.
+func LoadTitleTransforms(path string) ([]TitleTransform, error) {
+	data := defaultTitleTransforms
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	var transforms []TitleTransform
+	if err := json.Unmarshal(data, &transforms); err != nil {
+		return nil, fmt.Errorf("failed to parse title transforms: %w", err)
+	}
+	for i := range transforms {
+		matcher, err := regexp.Compile(transforms[i].Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid title transform %q: %w", transforms[i].Match, err)
+		}
+		transforms[i].matcher = matcher
+	}
+	return transforms, nil
+}
+
+// apply the transform to the search string.
+func (t *TitleTransform) apply(search string, parent func() string) string {
+	matches := t.matcher.FindAllStringSubmatchIndex(search, -1)
+	if len(matches) < 1 {
+		return search
+	}
+	template := t.Replace
+	if strings.Contains(template, "${parent}") {
+		parentSearch := parent()
+		if parentSearch == "" {
+			return search // A top level directory.
+		}
+		template = strings.ReplaceAll(template, "${parent}", strings.ReplaceAll(parentSearch, "$", "$$"))
+	}
+	var result []byte
+	last := 0
+	for _, match := range matches {
+		result = append(result, search[last:match[0]]...)
+		result = t.matcher.ExpandString(result, template, search, match)
+		last = match[1]
+	}
+	result = append(result, search[last:]...)
+	return strings.Join(strings.Fields(string(result)), " ")
+}
+
+// searchString returns the string to search AniList with for the given
+// directory.  Top level directories have no parent search string, so that the
+// names of the media root and above are not used.
+func (i *Injester) searchString(absPath string) string {
+	absPath = filepath.Clean(absPath)
+	search := filepath.Base(absPath)
+	for _, transform := range i.titleTransforms {
+		search = transform.apply(search, func() string {
+			parent := filepath.Dir(absPath)
+			if rel, err := filepath.Rel(i.root, parent); err == nil && rel != "." && filepath.IsLocal(rel) {
+				return i.searchString(parent)
+			}
+			return ""
+		})
+	}
+	return search
+}
+
+// SearchString returns the string that would be used to search AniList for
+// the given directory; relative paths are relative to the media root.
+func (i *Injester) SearchString(directory string) (string, error) {
+	if !filepath.IsAbs(directory) {
+		directory = filepath.Join(i.root, directory)
+	}
+	absPath, err := filepath.Abs(directory)
+	if err != nil {
+		return "", err
+	}
+	return i.searchString(absPath), nil
+}
@@ -0,0 +1,77 @@
+package injest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchString(t *testing.T) {
+	i := New(t.TempDir(), Options{})
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"Show", "Show"},
+		{"Show/Season 2", "Show 2"},
+		{"Show/season02", "Show 2"},
+		{"Show/2nd Season", "Show 2"},
+		{"Show/Part 2", "Show Part 2"},
+		{"Show/第2季", "Show 2"},
+		{"Show/第二季", "Show 2"},
+		{"[BD] Show [1080p]", "Show"},
+		{"[BD] Show/Season 3", "Show 3"},
+		{"Show (2019)", "Show"},
+		{"Show S2", "Show 2"},
+		{"Show 2nd Season", "Show 2"},
+		{"Show Season 3", "Show 3"},
+		{"86 Eighty-Six", "86 Eighty-Six"},
+		// The media root is not the parent of top level directories, so rules
+		// using the parent don't apply.
+		{"Season 2", "Season 2"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			t.Parallel()
+			actual := i.searchString(filepath.Join(i.root, testCase.path))
+			if actual != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSearchStringRelative(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "Season 1")
+	i := New(root, Options{})
+	testCases := []struct {
+		directory string
+		expected  string
+	}{
+		{"Show/Season 2", "Show 2"},
+		{filepath.Join(root, "Show", "Season 3"), "Show 3"},
+		{"Season 2", "Season 2"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.directory, func(t *testing.T) {
+			t.Parallel()
+			actual, err := i.SearchString(testCase.directory)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLoadTitleTransformsInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transforms.json")
+	if err := os.WriteFile(path, []byte(`[{"match": "(", "replace": ""}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTitleTransforms(path); err == nil {
+		t.Error("expected invalid regular expression to fail")
+	}
+}
@@ -0,0 +1,42 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "file")
+	for _, contents := range []string{"first", "second"} {
+		if err := WriteFile(path, []byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != contents {
+			t.Errorf("expected %q, got %q", contents, data)
+		}
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0o644 {
+		t.Errorf("expected mode 0644, got %s", stat.Mode())
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected temporary files to be removed, got %v", entries)
+	}
+
+	if err := WriteFile(filepath.Join(directory, "missing", "file"), nil); err == nil {
+		t.Error("expected writing into a missing directory to fail")
+	}
+}
@@ -0,0 +1,192 @@
+// Package intro finds sections shared between episodes, such as openings and
+// endings, by comparing fingerprints of their audio.  Audio is decoded by
+// spawning ffmpeg.
+package intro
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/cmplx"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const (
+	// The sample rate audio is decoded at.
+	sampleRate = 8000
+	// The number of samples in each fingerprint frame; must be a power of two.
+	frameSize = 2048
+	// The number of samples between the starts of consecutive frames.
+	hopSize = 256
+	// The number of frequency bands compared to make each hash.
+	bandCount = 32
+	// The range of frequencies fingerprinted, in hertz.
+	minFrequency = 300
+	maxFrequency = 2000
+	// Frames quieter than this (mean squared amplitude) are treated as silence.
+	silenceEnergy = 1e-6
+	// The maximum number of differing bits for two hashes to match.
+	maxBitErrors = 10
+	// The number of consecutive mismatching frames tolerated within a match.
+	maxGap = 4
+	// FrameDuration is the time between consecutive frames of a fingerprint.
+	FrameDuration = time.Second * hopSize / sampleRate
+)
+
+// Fingerprint is a sequence of hashes, one per frame, each describing how the
+// energy across frequency bands changes.  A hash of zero marks silence, which
+// never matches anything.
+type Fingerprint []uint32
+
+// Compute decodes the audio of a media file from the given start, for the
+// given length, and fingerprints it.
+func Compute(ctx context.Context, path string, start, length time.Duration) (Fingerprint, error) {
+	var buf bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-loglevel", "error",
+		"-ss", fmt.Sprintf("%f", start.Seconds()),
+		"-t", fmt.Sprintf("%f", length.Seconds()),
+		"-i", path,
+		"-vn",
+		"-ac", "1",
+		"-ar", fmt.Sprintf("%d", sampleRate),
+		"-f", "s16le",
+		"-")
+	cmd.Stdout = &buf
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	raw := make([]int16, buf.Len()/2)
+	if err := binary.Read(&buf, binary.LittleEndian, raw); err != nil {
+		return nil, err
+	}
+	samples := make([]float64, len(raw))
+	for i, sample := range raw {
+		samples[i] = float64(sample) / math.MaxInt16
+	}
+	return fingerprint(samples), nil
+}
+
+// bandEdges returns the FFT bin at which each band starts, and the bin after
+// the last band; bands are logarithmically spaced.
+func bandEdges() [bandCount + 1]int {
+	var edges [bandCount + 1]int
+	for i := range edges {
+		frequency := minFrequency * math.Pow(float64(maxFrequency)/minFrequency, float64(i)/bandCount)
+		edges[i] = int(frequency * frameSize / sampleRate)
+	}
+	return edges
+}
+
+// fingerprint computes the fingerprint of mono audio at sampleRate.
+func fingerprint(samples []float64) Fingerprint {
+	edges := bandEdges()
+	window := make([]float64, frameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/(frameSize-1))
+	}
+
+	var result Fingerprint
+	var previous [bandCount]float64
+	frame := make([]complex128, frameSize)
+	for offset := 0; offset+frameSize <= len(samples); offset += hopSize {
+		var energy float64
+		for i := range frame {
+			sample := samples[offset+i]
+			energy += sample * sample
+			frame[i] = complex(sample*window[i], 0)
+		}
+		fft(frame)
+		var bands [bandCount]float64
+		for band := range bands {
+			for bin := edges[band]; bin < edges[band+1]; bin++ {
+				bands[band] += cmplx.Abs(frame[bin]) * cmplx.Abs(frame[bin])
+			}
+		}
+		var hash uint32
+		if energy/frameSize > silenceEnergy && offset > 0 {
+			for band := range bandCount - 1 {
+				if (bands[band]-bands[band+1])-(previous[band]-previous[band+1]) > 0 {
+					hash |= 1 << band
+				}
+			}
+			hash |= 1 << 31 // Ensure non-silent frames are never zero.
+		}
+		previous = bands
+		result = append(result, hash)
+	}
+	return result
+}
+
+// fft performs an in-place radix-2 fast Fourier transform; the length of the
+// input must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := range size / 2 {
+				even, odd := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
+
+// Match is a section shared between two fingerprints.
+type Match struct {
+	// The offset of the section from the start of each fingerprint.
+	A, B time.Duration
+	// The length of the section.
+	Length time.Duration
+}
+
+// FindCommon finds the longest section shared between two fingerprints, if
+// it is at least the given length.
+func FindCommon(a, b Fingerprint, minLength time.Duration) (Match, bool) {
+	var bestStart, bestShift, bestLength int
+	for shift := -(len(b) - 1); shift < len(a); shift++ {
+		// Compare a[i] with b[i-shift].
+		start, last, gap := -1, -1, 0
+		for i := max(shift, 0); i < len(a) && i-shift < len(b); i++ {
+			x, y := a[i], b[i-shift]
+			if x != 0 && y != 0 && bits.OnesCount32(x^y) <= maxBitErrors {
+				if start < 0 {
+					start = i
+				}
+				last, gap = i, 0
+				if length := last - start + 1; length > bestLength {
+					bestStart, bestShift, bestLength = start, shift, length
+				}
+			} else if start >= 0 {
+				if gap++; gap > maxGap {
+					start = -1
+				}
+			}
+		}
+	}
+	match := Match{
+		A:      time.Duration(bestStart) * FrameDuration,
+		B:      time.Duration(bestStart-bestShift) * FrameDuration,
+		Length: time.Duration(bestLength) * FrameDuration,
+	}
+	return match, bestLength > 0 && match.Length >= minLength
+}
@@ -0,0 +1,62 @@
+package intro
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// noise generates reproducible random audio of the given length.
+func noise(seed uint64, length time.Duration) []float64 {
+	r := rand.New(rand.NewPCG(seed, seed))
+	result := make([]float64, int(length.Seconds()*sampleRate))
+	for i := range result {
+		result[i] = r.Float64()*2 - 1
+	}
+	return result
+}
+
+func TestFindCommon(t *testing.T) {
+	opening := noise(1, 30*time.Second)
+	// The opening starts at different times, not aligned to frames.
+	a := append(append(noise(2, 10*time.Second+123*time.Millisecond), opening...), noise(3, 40*time.Second)...)
+	b := append(append(noise(4, 45*time.Second+777*time.Millisecond), opening...), noise(5, 5*time.Second)...)
+
+	match, ok := FindCommon(fingerprint(a), fingerprint(b), 20*time.Second)
+	if !ok {
+		t.Fatalf("failed to find opening")
+	}
+	tolerance := time.Second * frameSize / sampleRate
+	within := func(actual, expected time.Duration) bool {
+		return actual > expected-tolerance && actual < expected+tolerance
+	}
+	if !within(match.A, 10*time.Second+123*time.Millisecond) ||
+		!within(match.B, 45*time.Second+777*time.Millisecond) ||
+		!within(match.Length, 30*time.Second) {
+		t.Errorf("unexpected match %+v", match)
+	}
+
+	if match, ok := FindCommon(fingerprint(noise(6, time.Minute)), fingerprint(b), 10*time.Second); ok {
+		t.Errorf("unexpected match between unrelated audio: %+v", match)
+	}
+
+	silence := make([]float64, 30*sampleRate)
+	if match, ok := FindCommon(fingerprint(silence), fingerprint(silence), 10*time.Second); ok {
+		t.Errorf("unexpected match between silence: %+v", match)
+	}
+}
+
+func TestBandEdges(t *testing.T) {
+	edges := bandEdges()
+	if expected := minFrequency * frameSize / sampleRate; edges[0] != expected {
+		t.Errorf("expected the first band to start at bin %d, got %d", expected, edges[0])
+	}
+	if expected := maxFrequency * frameSize / sampleRate; edges[bandCount] != expected {
+		t.Errorf("expected the last band to end at bin %d, got %d", expected, edges[bandCount])
+	}
+	for i := 1; i < len(edges); i++ {
+		if edges[i] <= edges[i-1] {
+			t.Errorf("band %d is empty: %v", i-1, edges)
+		}
+	}
+}
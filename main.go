@@ -18,6 +18,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"flag"
@@ -25,6 +26,8 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -34,8 +37,8 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
-func serve(ctx context.Context, mediaDir string, queue injest.Queue) error {
-	s := server.NewServer(mediaDir, queue)
+func serve(ctx context.Context, mediaDir string, queue injest.Queue, opts server.Options) error {
+	s := server.NewServer(mediaDir, queue, opts)
 
 	listener, err := (&net.ListenConfig{}).Listen(ctx, "tcp", ":"+os.Getenv("PORT"))
 	if err != nil {
@@ -51,7 +54,7 @@ func serve(ctx context.Context, mediaDir string, queue injest.Queue) error {
 	return nil
 }
 
-func doInjest(ctx context.Context, injester *injest.Injester) error {
+func doInjest(ctx context.Context, injester *injest.Injester, pull, collect bool) error {
 	var wg sync.WaitGroup
 	var err error
 	wg.Go(func() {
@@ -59,9 +62,23 @@ func doInjest(ctx context.Context, injester *injest.Injester) error {
 	})
 	wg.Go(func() {
 		time.Sleep(time.Millisecond)
+		if collect {
+			// This runs after the initial scan, so that the cache is only
+			// cleaned up once the media has been checked.
+			injester.Queue(injest.QueueOptions{
+				Directory: ".",
+				Collect:   true,
+			})
+		}
 		injester.Queue(injest.QueueOptions{
 			Directory: ".",
 		})
+		if pull {
+			injester.Queue(injest.QueueOptions{
+				Directory: ".",
+				Pull:      true,
+			})
+		}
 	})
 	wg.Wait()
 	if err != nil {
@@ -70,9 +87,136 @@ func doInjest(ctx context.Context, injester *injest.Injester) error {
 	return nil
 }
 
+// exportFormat returns the export format to use for the given file name.
+func exportFormat(name string) string {
+	if strings.EqualFold(filepath.Ext(name), ".csv") {
+		return injest.ExportCSV
+	}
+	return injest.ExportJSON
+}
+
+// splitList splits a comma separated list, ignoring empty items.
+func splitList(list string) []string {
+	var result []string
+	for item := range strings.SplitSeq(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// cacheDirectory returns the directory to store generated images in, and
+// whether stale images may be removed from it.  By default they are kept in
+// their own directory within the state directory, if any.  Nothing is removed
+// from a cache directory that holds the state directory, as that would remove
+// the state too.
+func cacheDirectory(cacheDir, stateDir string) (string, bool) {
+	if cacheDir == "" {
+		if stateDir == "" {
+			return "", false
+		}
+		return filepath.Join(stateDir, injest.CacheBaseName), true
+	}
+	if stateDir == "" {
+		return cacheDir, true
+	}
+	absCache, err := filepath.Abs(cacheDir)
+	if err != nil {
+		return cacheDir, false
+	}
+	absState, err := filepath.Abs(stateDir)
+	if err != nil {
+		return cacheDir, false
+	}
+	rel, err := filepath.Rel(absCache, absState)
+	return cacheDir, err == nil && !filepath.IsLocal(rel)
+}
+
+// exportState writes the watch state of the library to a file.
+func exportState(store injest.Store, mediaDir, outPath string) error {
+	records, err := injest.Export(store, mediaDir)
+	if err != nil {
+		return err
+	}
+	if outPath == "-" {
+		return injest.WriteExport(os.Stdout, injest.ExportJSON, records)
+	}
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := injest.WriteExport(f, exportFormat(outPath), records); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// importState merges the watch state from a file into the library, printing
+// the changes made.
+func importState(store injest.Store, mediaDir, inPath, strategy string, dryRun bool) error {
+	f, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	records, err := injest.ReadExport(f, exportFormat(inPath))
+	if err != nil {
+		return err
+	}
+	changes, err := injest.Import(store, mediaDir, records, strategy, dryRun)
+	for _, change := range changes {
+		fmt.Printf("%s: %v -> %v\n", change.Path, change.From, change.To)
+	}
+	return err
+}
+
 func run(ctx context.Context) error {
 	mediaDir := flag.String("dir", "/media", "listing directory root")
 	verbose := flag.Bool("verbose", false, "extra logging")
+	aniListToken := flag.String("anilist-token", "",
+		"AniList access token for synchronizing watch progress (default $ANILIST_TOKEN)")
+	aniListPull := flag.Bool("anilist-pull", false, "import watch progress from AniList on startup")
+	titleLanguage := flag.String("title-language", "",
+		"language of titles to display instead of directory names, e.g. ja-Latn")
+	translationLanguages := flag.String("translation-languages", "zh,en,ja",
+		"comma separated languages of titles to display as translations")
+	titleTransforms := flag.String("title-transforms", "",
+		"JSON file of rules to transform directory names into AniList searches")
+	trickplayInterval := flag.Duration("trickplay-interval", 0,
+		"interval between frames for seek previews; zero to disable")
+	previews := flag.Bool("previews", false, "generate animated previews of videos")
+	cacheDir := flag.String("cache-dir", "",
+		"directory to store generated images in, instead of hidden files next to the media (default "+
+			injest.CacheBaseName+" in the state directory, if any)")
+	stateDir := flag.String("state-dir", "",
+		"directory to save state and generated images in, so the media can be read only")
+	database := flag.String("database", "",
+		"embedded database file to save state in, instead of JSON files")
+	migrateDatabase := flag.Bool("migrate-database", false,
+		"copy state from JSON files into the database given by -database and exit")
+	exportPath := flag.String("export", "",
+		"write the watch state of the library to the given .json or .csv file (- for stdout) and exit")
+	importPath := flag.String("import", "",
+		"merge the watch state from the given .json or .csv file into the library and exit")
+	importStrategy := flag.String("import-strategy", injest.ImportNewest,
+		"how to merge imported watch state: overwrite, union or newest")
+	dryRun := flag.Bool("dry-run", false, "only print the changes an import would make")
+	migrateBackup := flag.String("migrate", "",
+		"back up saved state into the given directory, migrate it to the current format and exit")
+	mediaExtensions := flag.String("media-extensions", "",
+		"comma separated extensions of files to treat as media, in addition to the defaults")
+	excludeExtensions := flag.String("exclude-extensions", "",
+		"comma separated extensions of files to never treat as media")
+	probeMedia := flag.Bool("probe-media", false,
+		"probe files with unknown extensions to check if they are media")
+	ignore := flag.String("ignore", strings.Join(injest.DefaultIgnore, ","),
+		"comma separated patterns of files and directories to ignore everywhere, as in "+injest.IgnoreBaseName+" files")
+	historyPath := flag.String("history", "",
+		"file to log changes to watch state in (default .history.jsonl in the state directory)")
+	search := flag.String("search", "",
+		"print the AniList search string for the given directory (relative to -dir) and exit")
 	flag.Parse()
 
 	if *verbose {
@@ -81,19 +225,108 @@ func run(ctx context.Context) error {
 		logrus.SetLevel(logrus.WarnLevel)
 	}
 
+	transforms, err := injest.LoadTitleTransforms(*titleTransforms)
+	if err != nil {
+		return err
+	}
+
+	if *search != "" {
+		injester := injest.New(*mediaDir, injest.Options{TitleTransforms: transforms})
+		result, err := injester.SearchString(*search)
+		if err != nil {
+			return err
+		}
+		fmt.Println(result)
+		return nil
+	}
+
 	if info, err := os.Stat(*mediaDir); err != nil {
 		return fmt.Errorf("Media directory %s is invalid: %w", *mediaDir, err)
 	} else if !info.IsDir() {
 		return fmt.Errorf("Media directory %s is not a directory", *mediaDir)
 	}
 
-	injester := injest.New(*mediaDir)
+	if *aniListToken == "" {
+		*aniListToken = os.Getenv("ANILIST_TOKEN")
+	}
+	if *aniListPull && *aniListToken == "" {
+		return fmt.Errorf("Importing from AniList requires an access token")
+	}
+
+	mediaTypes, err := injest.NewMediaTypes(injest.MediaOptions{
+		Extensions: splitList(*mediaExtensions),
+		Excluded:   splitList(*excludeExtensions),
+		Probe:      *probeMedia,
+		ProbeCache: filepath.Join(cmp.Or(*stateDir, *mediaDir), injest.MediaTypesBaseName),
+		Ignore:     splitList(*ignore),
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to load media probe results: %w", err)
+	}
+
+	jsonStore, err := injest.NewJSONStore(*mediaDir, *stateDir, mediaTypes)
+	if err != nil {
+		return fmt.Errorf("State directory %s is invalid: %w", *stateDir, err)
+	}
+	var store injest.Store = jsonStore
+	if *database != "" {
+		boltStore, err := injest.NewBoltStore(*mediaDir, *database, mediaTypes)
+		if err != nil {
+			return fmt.Errorf("Database %s is invalid: %w", *database, err)
+		}
+		defer boltStore.Close()
+		if *migrateDatabase {
+			return injest.CopyStore(boltStore, jsonStore)
+		}
+		store = boltStore
+	} else if *migrateDatabase {
+		return fmt.Errorf("Migrating requires a database to migrate to")
+	}
+	if *migrateBackup != "" {
+		directories, err := injest.MigrateStore(store, *migrateBackup)
+		for _, directory := range directories {
+			fmt.Println(directory)
+		}
+		return err
+	}
+	if *exportPath != "" {
+		return exportState(store, *mediaDir, *exportPath)
+	}
+	if *importPath != "" {
+		return importState(store, *mediaDir, *importPath, *importStrategy, *dryRun)
+	}
+
+	cache, collect := cacheDirectory(*cacheDir, *stateDir)
+	artifacts, err := injest.NewArtifacts(*mediaDir, cache)
+	if err != nil {
+		return fmt.Errorf("Cache directory %s is invalid: %w", cache, err)
+	}
+
+	if *historyPath == "" {
+		*historyPath = filepath.Join(cmp.Or(*stateDir, *mediaDir), injest.HistoryBaseName)
+	}
+
+	injester := injest.New(*mediaDir, injest.Options{
+		AniListToken:      *aniListToken,
+		TitleTransforms:   transforms,
+		TrickplayInterval: *trickplayInterval,
+		Previews:          *previews,
+		Artifacts:         artifacts,
+		Store:             store,
+		MediaTypes:        mediaTypes,
+	})
 	wg, ctx := errgroup.WithContext(ctx)
 	wg.Go(func() error {
-		return serve(ctx, *mediaDir, injester.Queue)
+		return serve(ctx, *mediaDir, injester.Queue, server.Options{
+			PrimaryLanguage: *titleLanguage,
+			Languages:       splitList(*translationLanguages),
+			Artifacts:       artifacts,
+			Store:           store,
+			History:         injest.NewHistory(*historyPath),
+		})
 	})
 	wg.Go(func() error {
-		return doInjest(ctx, injester)
+		return doInjest(ctx, injester, *aniListPull, collect)
 	})
 
 	if err := wg.Wait(); err != nil {
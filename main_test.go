@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mook/video-listing/injest"
+)
+
+func TestCacheDirectory(t *testing.T) {
+	stateDir := t.TempDir()
+	testCases := []struct {
+		name     string
+		cacheDir string
+		stateDir string
+		expected string
+		collect  bool
+	}{
+		{"sidecar", "", "", "", false},
+		{"cache", "cache", "", "cache", true},
+		{"state", "", stateDir, filepath.Join(stateDir, injest.CacheBaseName), true},
+		{"separate", "cache", stateDir, "cache", true},
+		{"shared", stateDir, stateDir, stateDir, false},
+		{"parent", filepath.Dir(stateDir), stateDir, filepath.Dir(stateDir), false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cacheDir, collect := cacheDirectory(testCase.cacheDir, testCase.stateDir)
+			if cacheDir != testCase.expected || collect != testCase.collect {
+				t.Errorf("expected %q (collect %v), got %q (collect %v)",
+					testCase.expected, testCase.collect, cacheDir, collect)
+			}
+		})
+	}
+}
+
+// Collecting the default cache must not touch the state kept alongside it.
+func TestCollectStateDir(t *testing.T) {
+	mediaDir, stateDir := t.TempDir(), t.TempDir()
+	show := filepath.Join(mediaDir, "Show")
+	if err := os.Mkdir(show, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(show, "01.mkv"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := injest.NewBoltStore(mediaDir, filepath.Join(stateDir, "state.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.WriteInfo(show, &injest.InfoType{AniListID: 42}); err != nil {
+		t.Fatal(err)
+	}
+	// Information about a directory that has since been removed.
+	jsonStore, err := injest.NewJSONStore(mediaDir, stateDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jsonStore.WriteInfo(filepath.Join(mediaDir, "Gone"), &injest.InfoType{AniListID: 42}); err != nil {
+		t.Fatal(err)
+	}
+	history := filepath.Join(stateDir, "history.jsonl")
+	if err := os.WriteFile(history, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheDir, collect := cacheDirectory("", stateDir)
+	if !collect {
+		t.Fatal("expected the default cache to be collected")
+	}
+	artifacts, err := injest.NewArtifacts(mediaDir, cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(cacheDir, "Show", ".02.mkv.webp")
+	if err := os.MkdirAll(filepath.Dir(stale), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := artifacts.Collect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(stale); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected stale artifact to be removed: %v", err)
+	}
+	for _, path := range []string{filepath.Join(stateDir, "state.db"), filepath.Join(stateDir, "Gone"), history} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to be kept: %v", path, err)
+		}
+	}
+	if info, err := store.ReadInfo(show, false); err != nil || info.AniListID != 42 {
+		t.Errorf("database was damaged: %+v, %v", info, err)
+	}
+}
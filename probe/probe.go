@@ -0,0 +1,153 @@
+// Package probe inspects media files by spawning ffprobe.
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Stream describes a single audio or subtitle stream.
+type Stream struct {
+	// The index of the stream amongst streams of the same type.
+	Index    int    `json:"index"`
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+// Video describes the main video stream.
+type Video struct {
+	Codec  string `json:"codec"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	HDR    bool   `json:"hdr,omitempty"`
+}
+
+// Chapter is a named section of a media file.
+type Chapter struct {
+	// The start and end of the chapter, in seconds.
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Title string  `json:"title,omitempty"`
+}
+
+// Result is the technical metadata of a media file.
+type Result struct {
+	// The duration of the media, in seconds.
+	Duration float64 `json:"duration"`
+	// The size of the file, in bytes.
+	Size int64 `json:"size"`
+	// The container format, as named by ffprobe (e.g. "matroska,webm").
+	Container string    `json:"container"`
+	Video     *Video    `json:"video,omitempty"`
+	Audio     []Stream  `json:"audio,omitempty"`
+	Subtitles []Stream  `json:"subtitles,omitempty"`
+	Chapters  []Chapter `json:"chapters,omitempty"`
+}
+
+// Transfer characteristics indicating HDR video.
+var hdrTransfers = map[string]bool{
+	"smpte2084":    true, // PQ
+	"arib-std-b67": true, // HLG
+}
+
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType     string `json:"codec_type"`
+		CodecName     string `json:"codec_name"`
+		Width         int    `json:"width"`
+		Height        int    `json:"height"`
+		ColorTransfer string `json:"color_transfer"`
+		Disposition   struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+		Tags struct {
+			Language string `json:"language"`
+			Title    string `json:"title"`
+		} `json:"tags"`
+	} `json:"streams"`
+	Chapters []struct {
+		StartTime string `json:"start_time"`
+		EndTime   string `json:"end_time"`
+		Tags      struct {
+			Title string `json:"title"`
+		} `json:"tags"`
+	} `json:"chapters"`
+}
+
+// Probe inspects a media file.
+func Probe(ctx context.Context, path string) (*Result, error) {
+	var buf bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-loglevel", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		"-show_chapters",
+		path)
+	cmd.Stdout = &buf
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	var output ffprobeOutput
+	if err := json.Unmarshal(buf.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	return parse(&output), nil
+}
+
+// parse converts the ffprobe output into a result.
+func parse(output *ffprobeOutput) *Result {
+	result := &Result{Container: output.Format.FormatName}
+	result.Duration, _ = strconv.ParseFloat(output.Format.Duration, 64)
+	result.Size, _ = strconv.ParseInt(output.Format.Size, 10, 64)
+	for _, stream := range output.Streams {
+		switch stream.CodecType {
+		case "video":
+			if result.Video != nil || stream.Disposition.AttachedPic != 0 {
+				continue // Only keep the first real video stream, not cover art.
+			}
+			result.Video = &Video{
+				Codec:  stream.CodecName,
+				Width:  stream.Width,
+				Height: stream.Height,
+				HDR:    hdrTransfers[stream.ColorTransfer],
+			}
+		case "audio":
+			result.Audio = append(result.Audio, Stream{
+				Index:    len(result.Audio),
+				Codec:    stream.CodecName,
+				Language: stream.Tags.Language,
+				Title:    stream.Tags.Title,
+			})
+		case "subtitle":
+			result.Subtitles = append(result.Subtitles, Stream{
+				Index:    len(result.Subtitles),
+				Codec:    stream.CodecName,
+				Language: stream.Tags.Language,
+				Title:    stream.Tags.Title,
+			})
+		}
+	}
+	for _, chapter := range output.Chapters {
+		start, _ := strconv.ParseFloat(chapter.StartTime, 64)
+		end, _ := strconv.ParseFloat(chapter.EndTime, 64)
+		result.Chapters = append(result.Chapters, Chapter{
+			Start: start,
+			End:   end,
+			Title: chapter.Tags.Title,
+		})
+	}
+	return result
+}
@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		// The fixture in testdata, saved from `ffprobe -print_format json
+		// -show_format -show_streams -show_chapters`.
+		name     string
+		expected *Result
+	}{
+		{"episode.json", &Result{
+			Duration:  1425.024,
+			Size:      367001600,
+			Container: "matroska,webm",
+			// The cover art attachment is skipped.
+			Video: &Video{Codec: "h264", Width: 1920, Height: 1080},
+			Audio: []Stream{
+				{Index: 0, Codec: "aac", Language: "jpn"},
+				{Index: 1, Codec: "ac3", Language: "eng", Title: "English Dub"},
+			},
+			Subtitles: []Stream{
+				{Index: 0, Codec: "ass", Language: "eng", Title: "Signs & Songs"},
+				{Index: 1, Codec: "subrip", Language: "chi"},
+			},
+			Chapters: []Chapter{
+				{Start: 0, End: 90, Title: "Opening"},
+				{Start: 90, End: 1335.5, Title: "Part A"},
+				{Start: 1335.5, End: 1425.024},
+			},
+		}},
+		{"hdr.json", &Result{
+			Duration:  7260.5,
+			Size:      12884901888,
+			Container: "mov,mp4,m4a,3gp,3g2,mj2",
+			// Only the first video stream is kept.
+			Video: &Video{Codec: "hevc", Width: 3840, Height: 2160, HDR: true},
+			Audio: []Stream{{Index: 0, Codec: "eac3"}},
+		}},
+		{"hlg.json", &Result{
+			Duration:  12,
+			Size:      1048576,
+			Container: "matroska,webm",
+			Video:     &Video{Codec: "vp9", Width: 1280, Height: 720, HDR: true},
+		}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			data, err := os.ReadFile(filepath.Join("testdata", testCase.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var output ffprobeOutput
+			if err := json.Unmarshal(data, &output); err != nil {
+				t.Fatal(err)
+			}
+			actual := parse(&output)
+			if !reflect.DeepEqual(actual, testCase.expected) {
+				expected, _ := json.Marshal(testCase.expected)
+				got, _ := json.Marshal(actual)
+				t.Errorf("expected %s, got %s", expected, got)
+			}
+		})
+	}
+}
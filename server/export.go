@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mook/video-listing/injest"
+	"github.com/sirupsen/logrus"
+)
+
+// ServeExport downloads the watch state of the whole library.  The `format`
+// query parameter selects JSON (the default) or CSV.
+func (s *server) ServeExport(w http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = injest.ExportJSON
+	}
+	contentType, ok := map[string]string{
+		injest.ExportJSON: "application/json",
+		injest.ExportCSV:  "text/csv",
+	}[format]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Unknown format %q", format)
+		return
+	}
+	records, err := injest.Export(s.store, s.root)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to export watch state")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="watch-state.%s"`, format))
+	if err := injest.WriteExport(w, format, records); err != nil {
+		logrus.WithError(err).Error("Failed to write exported watch state")
+	}
+}
+
+// ServeImport merges the watch state in the request body into the library.
+// The `format` query parameter is as for ServeExport; `strategy` selects how
+// to merge (defaulting to injest.ImportNewest), and if `dry-run` is set
+// nothing is changed.  The changes are returned as JSON.
+func (s *server) ServeImport(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = injest.ExportJSON
+	}
+	strategy := query.Get("strategy")
+	if strategy == "" {
+		strategy = injest.ImportNewest
+	} else if !slices.Contains(injest.ImportStrategies, strategy) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Unknown strategy %q", strategy)
+		return
+	}
+	dryRun := false
+	if value := query.Get("dry-run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "Invalid dry-run value %q", value)
+			return
+		}
+	}
+	records, err := injest.ReadExport(req.Body, format)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Failed to read watch state: %s", err)
+		return
+	}
+	changes, err := injest.Import(s.store, s.root, records, strategy, dryRun)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to import watch state")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "Failed to import watch state: %s", err)
+		return
+	}
+	if changes == nil {
+		changes = []injest.ImportChange{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
+		logrus.WithError(err).Error("Failed to write import changes")
+	}
+}
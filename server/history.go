@@ -0,0 +1,158 @@
+package server
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mook/video-listing/injest"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed history.html
+var historyTemplateText string
+var historyTmpl = template.Must(template.New("history.html").Parse(historyTemplateText))
+
+type historyEntry struct {
+	// The time of day of the event.
+	Time string
+	User string
+	// The directory containing the file, relative to the media root.
+	Series        string
+	EscapedSeries string
+	File          string
+	Seen          bool
+}
+
+type historyDay struct {
+	Date    string
+	Entries []historyEntry
+}
+
+type historyInput struct {
+	// The directory the history is limited to, if any.
+	Series        string
+	EscapedSeries string
+	Days          []historyDay
+}
+
+// escapePath escapes each segment of a slash separated relative path.
+func escapePath(relPath string) string {
+	var parts []string
+	for part := range strings.SplitSeq(relPath, "/") {
+		parts = append(parts, url.PathEscape(part))
+	}
+	return strings.Join(parts, "/")
+}
+
+// groupHistory groups history events by the day they happened in the given
+// location, most recent first.  If series is not empty, only events for files
+// directly in that directory are included.
+func groupHistory(events []injest.HistoryEvent, series string, loc *time.Location) []historyDay {
+	var days []historyDay
+	for _, event := range slices.Backward(events) {
+		dir, file := path.Split(event.Path)
+		dir = path.Clean(dir)
+		if series != "" && dir != series {
+			continue
+		}
+		when := event.Time.In(loc)
+		date := when.Format("Monday, 2 January 2006")
+		if len(days) < 1 || days[len(days)-1].Date != date {
+			days = append(days, historyDay{Date: date})
+		}
+		day := &days[len(days)-1]
+		day.Entries = append(day.Entries, historyEntry{
+			Time:          when.Format("15:04"),
+			User:          event.User,
+			Series:        dir,
+			EscapedSeries: escapePath(dir),
+			File:          file,
+			Seen:          event.Seen,
+		})
+	}
+	return days
+}
+
+// requestUser describes who made a request: the user authenticated by a
+// reverse proxy if there is one, or else the client address.
+func requestUser(req *http.Request) string {
+	if user := req.Header.Get("Remote-User"); user != "" {
+		return user
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// errNoHistory is returned when recording history without a history file.
+var errNoHistory = errors.New("history is not enabled")
+
+// recordHistory logs changes to the seen state of files in a directory, as
+// part of the given operation.  Failures are logged, as the change itself has
+// already been saved; the returned error only means the operation can't be
+// undone.
+func (s *server) recordHistory(req *http.Request, operation, directory string, seen map[string]bool) error {
+	if s.history == nil {
+		return errNoHistory
+	}
+	relPath, err := filepath.Rel(s.root, directory)
+	if err != nil {
+		logrus.WithError(err).WithField("path", directory).Error("Failed to get relative path")
+		return err
+	}
+	now := time.Now()
+	user := requestUser(req)
+	var events []injest.HistoryEvent
+	for _, name := range slices.Sorted(maps.Keys(seen)) {
+		events = append(events, injest.HistoryEvent{
+			Time:      now,
+			User:      user,
+			Path:      path.Join(filepath.ToSlash(relPath), name),
+			Seen:      seen[name],
+			Operation: operation,
+		})
+	}
+	if err := s.history.Append(events...); err != nil {
+		logrus.WithError(err).WithField("path", relPath).Error("Failed to record history")
+		return err
+	}
+	return nil
+}
+
+// ServeHistory shows when files were marked as seen or not seen, grouped by
+// day.  If the URL has a path, it is limited to files in that directory.
+func (s *server) ServeHistory(w http.ResponseWriter, req *http.Request) {
+	var input historyInput
+	if series := strings.Trim(req.URL.Path, "/"); series != "" {
+		input.Series = path.Clean(series)
+		if !fs.ValidPath(input.Series) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, `Invalid path "%s"`, series)
+			return
+		}
+		input.EscapedSeries = escapePath(input.Series)
+	}
+	events, err := s.history.Read()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to read history")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	input.Days = groupHistory(events, input.Series, time.Local)
+	if err := historyTmpl.Execute(w, input); err != nil {
+		logrus.WithError(err).Error("Failed to render template")
+	}
+}
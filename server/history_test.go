@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mook/video-listing/injest"
+)
+
+func TestGroupHistory(t *testing.T) {
+	at := func(day, hour int) time.Time {
+		return time.Date(2024, 1, day, hour, 30, 0, 0, time.UTC)
+	}
+	events := []injest.HistoryEvent{
+		{Time: at(1, 9), Path: "show/1.mkv", Seen: true},
+		{Time: at(1, 21), Path: "other show/1.mkv", Seen: true},
+		{Time: at(2, 8), Path: "show/2.mkv", Seen: true},
+		{Time: at(2, 9), Path: "show/2.mkv", Seen: false},
+		{Time: at(2, 10), Path: "show/nested/1.mkv", Seen: true},
+	}
+	summarize := func(days []historyDay) []string {
+		var result []string
+		for _, day := range days {
+			result = append(result, day.Date)
+			for _, entry := range day.Entries {
+				result = append(result, entry.Time+" "+entry.EscapedSeries+" "+entry.File)
+			}
+		}
+		return result
+	}
+	testCases := []struct {
+		name     string
+		series   string
+		loc      *time.Location
+		expected []string
+	}{
+		{"all", "", time.UTC, []string{
+			"Tuesday, 2 January 2024",
+			"10:30 show/nested 1.mkv",
+			"09:30 show 2.mkv",
+			"08:30 show 2.mkv",
+			"Monday, 1 January 2024",
+			"21:30 other%20show 1.mkv",
+			"09:30 show 1.mkv",
+		}},
+		{"series", "show", time.UTC, []string{
+			"Tuesday, 2 January 2024",
+			"09:30 show 2.mkv",
+			"08:30 show 2.mkv",
+			"Monday, 1 January 2024",
+			"09:30 show 1.mkv",
+		}},
+		{"time zone", "other show", time.FixedZone("UTC+5", 5*60*60), []string{
+			"Tuesday, 2 January 2024",
+			"02:30 other%20show 1.mkv",
+		}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			actual := summarize(groupHistory(events, testCase.series, testCase.loc))
+			if !slices.Equal(actual, testCase.expected) {
+				t.Errorf("expected %q, got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRequestUser(t *testing.T) {
+	testCases := []struct {
+		name       string
+		remoteUser string
+		remoteAddr string
+		expected   string
+	}{
+		{"authenticated", "alice", "192.0.2.1:1234", "alice"},
+		{"address", "", "192.0.2.1:1234", "192.0.2.1"},
+		{"ipv6", "", "[2001:db8::1]:1234", "2001:db8::1"},
+		{"no port", "", "192.0.2.1", "192.0.2.1"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			req := &http.Request{Header: http.Header{}, RemoteAddr: testCase.remoteAddr}
+			if testCase.remoteUser != "" {
+				req.Header.Set("Remote-User", testCase.remoteUser)
+			}
+			if actual := requestUser(req); actual != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
@@ -3,13 +3,15 @@ package server
 import (
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 
+	"github.com/mook/video-listing/injest"
+	"github.com/mook/video-listing/thumbnail"
 	"github.com/sirupsen/logrus"
 )
 
@@ -57,19 +59,48 @@ func (s *server) ServeFallbackImage(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// ServeImage serves the cover of a directory or the thumbnail of a file.  If the
+// `w` query parameter is given, a variant at least that wide (if available) is
+// served instead; resized covers are created on demand.
 func (s *server) ServeImage(w http.ResponseWriter, req *http.Request) {
 	fullPath, isDir, err := s.getPath(w, req)
 	if err != nil {
 		return // Already wrote the response
 	}
-	log := logrus.WithField("path", fullPath)
-	var f io.ReadCloser
+	width := 0
+	if value := req.URL.Query().Get("w"); value != "" {
+		if width, err = strconv.Atoi(value); err != nil || width < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		width = thumbnail.PickWidth(width)
+	}
+	log := logrus.WithField("path", fullPath).WithField("width", width)
+	var f *os.File
 	if isDir {
-		f, err = os.Open(filepath.Join(fullPath, ".cover.jpg"))
+		coverPath := s.artifacts.Path(injest.CoverPath(fullPath))
+		if width > 0 {
+			sizedPath, err := s.artifacts.WritePath(thumbnail.SizedPath(injest.CoverPath(fullPath), width))
+			if err == nil {
+				err = updateResized(coverPath, sizedPath, width)
+			}
+			if err == nil {
+				coverPath = sizedPath
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				log.WithError(err).Error("Failed to resize cover image")
+			}
+		}
+		f, err = os.Open(coverPath)
 		log.WithError(err).Debug("Opened cover image")
 	} else {
 		dir, base := filepath.Split(fullPath)
-		f, err = os.Open(filepath.Join(dir, fmt.Sprintf(".%s.webp", base)))
+		thumbPath := injest.ThumbnailPath(fullPath)
+		if width > 0 {
+			f, err = os.Open(s.artifacts.Path(thumbnail.SizedPath(thumbPath, width)))
+		}
+		if f == nil {
+			f, err = os.Open(s.artifacts.Path(thumbPath))
+		}
 		if errors.Is(err, fs.ErrNotExist) {
 			f, err = os.Open(filepath.Join(dir, fmt.Sprintf(".%s.jpg", base)))
 		}
@@ -85,8 +116,53 @@ func (s *server) ServeImage(w http.ResponseWriter, req *http.Request) {
 	}
 	defer f.Close()
 
-	_, err = io.Copy(w, f)
+	stat, err := f.Stat()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, req, stat.Name(), stat.ModTime(), f)
+}
+
+// updateResized ensures the resized image at destPath is at least as new as the
+// image at srcPath, creating it if necessary.
+func updateResized(srcPath, destPath string, width int) error {
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	if destInfo, err := os.Stat(destPath); err == nil && !destInfo.ModTime().Before(srcInfo.ModTime()) {
+		return nil
+	}
+	return thumbnail.ResizeFile(srcPath, destPath, width)
+}
+
+// ServePreview serves the animated preview of a video.
+func (s *server) ServePreview(w http.ResponseWriter, req *http.Request) {
+	fullPath, isDir, err := s.getPath(w, req)
 	if err != nil {
-		log.WithError(err).Debug("Failed to write cover image")
+		return // Already wrote the response
+	}
+	if isDir {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(s.artifacts.Path(injest.PreviewPath(fullPath)))
+	if err != nil {
+		logrus.WithError(err).WithField("path", fullPath).Debug("Failed to open preview")
+		if errors.Is(err, fs.ErrNotExist) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+	w.Header().Set("Content-Type", "image/webp")
+	http.ServeContent(w, req, stat.Name(), stat.ModTime(), f)
 }
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mook/video-listing/injest"
+	"github.com/mook/video-listing/thumbnail"
+)
+
+func TestServePreview(t *testing.T) {
+	root := t.TempDir()
+	show := filepath.Join(root, "show")
+	if err := os.Mkdir(show, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"with.mkv", "without.mkv"} {
+		if err := os.WriteFile(filepath.Join(show, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	preview := []byte("RIFF\x00\x00\x00\x00WEBP")
+	if err := os.WriteFile(injest.PreviewPath(filepath.Join(show, "with.mkv")), preview, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := injest.NewJSONStore(root, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewServer(root, func(injest.QueueOptions) {}, Options{Store: store})
+
+	testCases := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"present", "/p/show/with.mkv", http.StatusOK},
+		{"missing", "/p/show/without.mkv", http.StatusNotFound},
+		{"no video", "/p/show/other.mkv", http.StatusNotFound},
+		{"directory", "/p/show", http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, testCase.path, nil))
+			if w.Code != testCase.status {
+				t.Fatalf("expected status %d, got %d", testCase.status, w.Code)
+			}
+			if testCase.status != http.StatusOK {
+				return
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "image/webp" {
+				t.Errorf("expected WebP content type, got %q", contentType)
+			}
+			if w.Body.String() != string(preview) {
+				t.Errorf("unexpected body %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServeImageWidth(t *testing.T) {
+	root := t.TempDir()
+	show := filepath.Join(root, "show")
+	if err := os.Mkdir(show, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var cover bytes.Buffer
+	if err := jpeg.Encode(&cover, image.NewRGBA(image.Rect(0, 0, 800, 400)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(injest.CoverPath(show), cover.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	video := filepath.Join(show, "01.mkv")
+	thumbPath := injest.ThumbnailPath(video)
+	files := map[string]string{
+		video:                               "",
+		thumbPath:                           "full",
+		thumbnail.SizedPath(thumbPath, 160): "small",
+	}
+	for path, contents := range files {
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := injest.NewJSONStore(root, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewServer(root, func(injest.QueueOptions) {}, Options{Store: store})
+	get := func(url string, expectedStatus int) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != expectedStatus {
+			t.Fatalf("%s: expected status %d, got %d", url, expectedStatus, w.Code)
+		}
+		return w
+	}
+
+	t.Run("cover", func(t *testing.T) {
+		testCases := []struct {
+			query string
+			width int
+		}{
+			{"", 800},
+			{"?w=200", 320},
+			{"?w=2000", 640},
+		}
+		for _, testCase := range testCases {
+			w := get("/i/show"+testCase.query, http.StatusOK)
+			config, _, err := image.DecodeConfig(w.Body)
+			if err != nil {
+				t.Fatalf("%s: %s", testCase.query, err)
+			}
+			if config.Width != testCase.width {
+				t.Errorf("%s: expected width %d, got %d", testCase.query, testCase.width, config.Width)
+			}
+		}
+		if _, err := os.Stat(thumbnail.SizedPath(injest.CoverPath(show), 320)); err != nil {
+			t.Errorf("resized cover was not saved: %s", err)
+		}
+	})
+
+	t.Run("thumbnail", func(t *testing.T) {
+		testCases := []struct {
+			query    string
+			expected string
+		}{
+			{"", "full"},
+			{"?w=100", "small"},
+			// Missing variants fall back to the full size thumbnail.
+			{"?w=300", "full"},
+		}
+		for _, testCase := range testCases {
+			if actual := get("/i/show/01.mkv"+testCase.query, http.StatusOK).Body.String(); actual != testCase.expected {
+				t.Errorf("%s: expected %q, got %q", testCase.query, testCase.expected, actual)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, query := range []string{"?w=0", "?w=-1", "?w=wide"} {
+			get("/i/show/01.mkv"+query, http.StatusBadRequest)
+		}
+	})
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/mook/video-listing/injest"
 	"github.com/sirupsen/logrus"
 )
 
@@ -28,7 +27,7 @@ func (s *server) ServeJSON(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	info, err := injest.ReadInfo(fullPath, true)
+	info, err := s.store.ReadInfo(fullPath, true)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		logrus.WithError(err).WithField("path", fullPath).Error("Error reading directory")
@@ -3,14 +3,17 @@ package server
 import (
 	"cmp"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"slices"
 	"strings"
 
 	"github.com/mook/video-listing/injest"
+	"github.com/mook/video-listing/probe"
 	"github.com/sirupsen/logrus"
 )
 
@@ -60,23 +63,171 @@ type entry struct {
 
 type directoryInput struct {
 	entry
+	// The title to display; this may be the same as the name.
+	Title        string
 	HasMedia     bool
 	Translations []string
+	// A summary of the total and remaining runtime, if known.
+	Runtime string
 }
 
 type fileInput struct {
 	entry
 	// The short title of the file.
 	Title string
+	// Whether an animated preview is available.
+	HasPreview bool
+	// A summary of the technical details of the file, if known.
+	Details string
+}
+
+// externalLink is a link to the media in an external database.
+type externalLink struct {
+	Name string
+	URL  string
+}
+
+// externalLinks describes how to build links from external IDs, in the order
+// they should be displayed.
+var externalLinks = []struct {
+	key    string
+	name   string
+	format string
+}{
+	{injest.IDMyAnimeList, "MAL", "https://myanimelist.net/anime/%s"},
+	{injest.IDKitsu, "Kitsu", "https://kitsu.app/anime/%s"},
+	{injest.IDAniDB, "AniDB", "https://anidb.net/anime/%s"},
+	{injest.IDBangumi, "Bangumi", "https://bgm.tv/subject/%s"},
+	{injest.IDBahamut, "巴哈姆特", "https://acg.gamer.com.tw/acgDetail.php?s=%s"},
+	{injest.IDTMDBTV, "TMDB", "https://www.themoviedb.org/tv/%s"},
+	{injest.IDTMDBMovie, "TMDB", "https://www.themoviedb.org/movie/%s"},
+}
+
+// mediaLinks returns the links to the media on AniList and in any external
+// databases with known IDs; unknown kinds of IDs are skipped.
+func mediaLinks(info *injest.InfoType) []externalLink {
+	var links []externalLink
+	if info.AniListID > 0 {
+		links = append(links, externalLink{
+			Name: "AniList",
+			URL:  fmt.Sprintf("https://anilist.co/anime/%d", info.AniListID),
+		})
+	}
+	for _, link := range externalLinks {
+		if id := info.ExternalIDs[link.key]; id != "" {
+			links = append(links, externalLink{
+				Name: link.name,
+				URL:  fmt.Sprintf(link.format, url.PathEscape(id)),
+			})
+		}
+	}
+	return links
 }
 
 type templateInput struct {
 	directoryInput
-	AniListID   int
+	AniListID int
+	// Whether the AniList match needs to be reviewed.
+	NeedsReview bool
+	Links       []externalLink
 	Directories []directoryInput
 	Files       []fileInput
 }
 
+// formatDuration formats a duration in seconds as h:mm:ss or m:ss.
+func formatDuration(seconds float64) string {
+	total := int(math.Round(seconds))
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total/60%60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// formatSize formats a size in bytes for humans.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exponent := float64(size)/unit, 0
+	for value >= unit && exponent < 3 {
+		value /= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[exponent])
+}
+
+// formatRuntime summarizes the runtime totals of a directory.
+func formatRuntime(runtime injest.Runtime) string {
+	if runtime.Total <= 0 {
+		return ""
+	}
+	if runtime.Remaining() < 1 {
+		return fmt.Sprintf("%s, all watched", formatDuration(runtime.Total))
+	}
+	return fmt.Sprintf("%s left of %s", formatDuration(runtime.Remaining()), formatDuration(runtime.Total))
+}
+
+// streamLanguages lists the languages of the given streams.
+func streamLanguages(streams []probe.Stream) string {
+	var languages []string
+	for _, stream := range streams {
+		language := cmp.Or(stream.Language, "und")
+		if !slices.Contains(languages, language) {
+			languages = append(languages, language)
+		}
+	}
+	return strings.Join(languages, ", ")
+}
+
+// fileDetails summarizes the technical details of a media file.
+func fileDetails(result *probe.Result) string {
+	if result == nil {
+		return ""
+	}
+	var parts []string
+	if video := result.Video; video != nil {
+		description := fmt.Sprintf("%dp %s", video.Height, strings.ToUpper(video.Codec))
+		if video.HDR {
+			description += " HDR"
+		}
+		parts = append(parts, description)
+	}
+	if result.Duration > 0 {
+		parts = append(parts, formatDuration(result.Duration))
+	}
+	if result.Size > 0 {
+		parts = append(parts, formatSize(result.Size))
+	}
+	if len(result.Audio) > 0 {
+		parts = append(parts, "Audio: "+streamLanguages(result.Audio))
+	}
+	if len(result.Subtitles) > 0 {
+		parts = append(parts, "Subs: "+streamLanguages(result.Subtitles))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// titles returns the title to display for a directory, as well as the titles to
+// display as translations, based on the configured languages.
+func (s *server) titles(info *injest.InfoType, name string) (string, []string) {
+	title := name
+	var translations []string
+	if s.primaryLanguage != "" {
+		if primary := info.Title(s.primaryLanguage); primary != "" && primary != name {
+			title = primary
+			translations = append(translations, name)
+		}
+	}
+	for _, lang := range s.languages {
+		translation := info.Title(lang)
+		if translation != "" && translation != title && !slices.Contains(translations, translation) {
+			translations = append(translations, translation)
+		}
+	}
+	return title, translations
+}
+
 func (s *server) ServeListing(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -96,7 +247,7 @@ func (s *server) ServeListing(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	info, err := injest.ReadInfo(fullPath, true)
+	info, err := s.store.ReadInfo(fullPath, true)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		logrus.WithError(err).WithField("path", fullPath).Error("Error reading directory")
@@ -111,20 +262,27 @@ func (s *server) ServeListing(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 	input := templateInput{
-		AniListID: info.AniListID,
+		AniListID:   info.AniListID,
+		NeedsReview: info.Review != nil,
 		directoryInput: directoryInput{
 			entry: entry{
 				Fallback:        directoryFallback,
 				Name:            path.Base(fullPath),
 				EscapedFullPath: path.Join(escapedPathParts...),
 			},
-			HasMedia:     len(info.Seen) > 0,
-			Translations: []string{info.ChineseTitle, info.EnglishTitle, info.NativeTitle},
+			HasMedia: len(info.Seen) > 0,
+			Runtime:  formatRuntime(info.Runtime),
 		},
 	}
+	input.Title, input.Translations = s.titles(info, input.Name)
 	if input.HasMedia {
 		input.Fallback = mediaDirectoryFallback
 	}
+	if info.Review != nil {
+		// Suggest the uncertain match in the override dialog.
+		input.AniListID = info.Review.ID
+	}
+	input.Links = mediaLinks(info)
 
 	for directory := range info.Injested {
 		child := directoryInput{
@@ -133,15 +291,13 @@ func (s *server) ServeListing(w http.ResponseWriter, req *http.Request) {
 				Name:            directory,
 				EscapedFullPath: path.Join(input.EscapedFullPath, url.PathEscape(directory)),
 			},
+			Title: directory,
 		}
-		childInfo, err := injest.ReadInfo(filepath.Join(fullPath, directory), true)
+		childInfo, err := s.store.ReadInfo(filepath.Join(fullPath, directory), true)
 		if err == nil {
 			child.HasMedia = len(childInfo.Seen) > 0
-			child.Translations = []string{
-				childInfo.ChineseTitle,
-				childInfo.EnglishTitle,
-				childInfo.NativeTitle,
-			}
+			child.Runtime = formatRuntime(childInfo.Runtime)
+			child.Title, child.Translations = s.titles(childInfo, directory)
 			if child.HasMedia {
 				child.Fallback = mediaDirectoryFallback
 			}
@@ -153,19 +309,24 @@ func (s *server) ServeListing(w http.ResponseWriter, req *http.Request) {
 		input.Directories = append(input.Directories, child)
 	}
 	slices.SortFunc(input.Directories, func(a, b directoryInput) int {
-		return cmp.Compare(a.Name, b.Name)
+		return cmp.Compare(a.Title, b.Title)
 	})
 
 	for file, seen := range info.Seen {
+		_, err := os.Stat(s.artifacts.Path(injest.PreviewPath(filepath.Join(fullPath, file))))
 		input.Files = append(input.Files, fileInput{
 			entry: entry{
 				Fallback:        fileFallback,
 				Name:            file,
-				EscapedFullPath: path.Join(append(slices.Clone(escapedPathParts), file)...),
+				EscapedFullPath: path.Join(append(slices.Clone(escapedPathParts), url.PathEscape(file))...),
 				Seen:            seen,
 			},
-			Title: file,
+			Title:      file,
+			HasPreview: err == nil,
 		})
+		if fileInfo := info.Files[file]; fileInfo != nil {
+			input.Files[len(input.Files)-1].Details = fileDetails(fileInfo.Probe)
+		}
 	}
 
 	// Post process: Strip common prefix and suffix of the strings
@@ -1,8 +1,16 @@
 package server
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/mook/video-listing/injest"
+	"github.com/mook/video-listing/probe"
 )
 
 func TestCommonLength(t *testing.T) {
@@ -34,3 +42,112 @@ func TestCommonLength(t *testing.T) {
 		})
 	}
 }
+
+func TestFileDetails(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    *probe.Result
+		expected string
+	}{
+		{"unknown", nil, ""},
+		{"empty", &probe.Result{}, ""},
+		{
+			"full",
+			&probe.Result{
+				Duration:  1425.4,
+				Size:      1288490189,
+				Video:     &probe.Video{Codec: "hevc", Width: 1920, Height: 1080, HDR: true},
+				Audio:     []probe.Stream{{Language: "jpn"}, {Language: "eng"}},
+				Subtitles: []probe.Stream{{Language: "chi"}, {Language: "chi"}, {}},
+			},
+			"1080p HEVC HDR · 23:45 · 1.2 GiB · Audio: jpn, eng · Subs: chi, und",
+		},
+		{"long", &probe.Result{Duration: 7384}, "2:03:04"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			if actual := fileDetails(testCase.input); actual != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMediaLinks(t *testing.T) {
+	testCases := []struct {
+		name     string
+		info     *injest.InfoType
+		expected []externalLink
+	}{
+		{"none", &injest.InfoType{}, nil},
+		{"not found", &injest.InfoType{AniListID: -1}, nil},
+		{
+			"all",
+			&injest.InfoType{
+				AniListID: 16498,
+				ExternalIDs: map[string]string{
+					injest.IDTMDBMovie:   "1000",
+					injest.IDTMDBTV:      "1429",
+					injest.IDBahamut:     "57479",
+					injest.IDBangumi:     "55770",
+					injest.IDAniDB:       "9541",
+					injest.IDKitsu:       "7442",
+					injest.IDMyAnimeList: "16498",
+				},
+			},
+			[]externalLink{
+				{"AniList", "https://anilist.co/anime/16498"},
+				{"MAL", "https://myanimelist.net/anime/16498"},
+				{"Kitsu", "https://kitsu.app/anime/7442"},
+				{"AniDB", "https://anidb.net/anime/9541"},
+				{"Bangumi", "https://bgm.tv/subject/55770"},
+				{"巴哈姆特", "https://acg.gamer.com.tw/acgDetail.php?s=57479"},
+				{"TMDB", "https://www.themoviedb.org/tv/1429"},
+				{"TMDB", "https://www.themoviedb.org/movie/1000"},
+			},
+		},
+		{
+			"unknown and empty",
+			&injest.InfoType{ExternalIDs: map[string]string{
+				"unknown":        "1",
+				injest.IDKitsu:   "",
+				injest.IDBangumi: "a/b",
+			}},
+			[]externalLink{{"Bangumi", "https://bgm.tv/subject/a%2Fb"}},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			if actual := mediaLinks(testCase.info); !slices.Equal(actual, testCase.expected) {
+				t.Errorf("expected %+v, got %+v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestListingEscapesFiles(t *testing.T) {
+	root := t.TempDir()
+	show := filepath.Join(root, "a show")
+	if err := os.Mkdir(show, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(show, "100% #1?.mkv"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := injest.NewJSONStore(root, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewServer(root, func(injest.QueueOptions) {}, Options{Store: store})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/l/a%20show/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	expected := `data-path="a%20show/100%25%20%231%3F.mkv"`
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("expected listing to contain %s", expected)
+	}
+}
@@ -1,9 +1,12 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"path"
+	"path/filepath"
 	"strconv"
 
 	"github.com/mook/video-listing/injest"
@@ -38,25 +41,43 @@ func (s *server) ServeMark(w http.ResponseWriter, req *http.Request) {
 	}
 
 	dir, base := path.Split(fullPath)
-	info, err := injest.ReadInfo(dir, false)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		logrus.WithError(err).Debug("Error reading state")
-		_, _ = fmt.Fprintf(w, `Error reading state`)
-		return
-	}
-	if _, ok := info.Seen[base]; !ok {
+	changed := false
+	err = s.store.Update(dir, false, func(info *injest.InfoType) error {
+		current, ok := info.Seen[base]
+		if !ok {
+			return fs.ErrNotExist
+		}
+		if changed = current != state; !changed {
+			return injest.SkipWrite
+		}
+		info.SetSeen(base, state)
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
 		w.WriteHeader(http.StatusNotFound)
 		logrus.WithError(err).Debug("Writing state for invalid file")
 		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logrus.WithError(err).Debug("Error updating state")
+		_, _ = fmt.Fprintf(w, `Error updating state`)
+		return
 	}
 
-	info.Seen[base] = state
+	var response operationResponse
+	if changed {
+		response = operationResponse{Operation: newOperation(), Changed: 1}
+		if err := s.recordHistory(req, response.Operation, dir, map[string]bool{base: state}); err != nil {
+			response.Operation = "" // Can't be undone.
+		}
+	}
 
-	if err := injest.WriteInfo(dir, info); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		logrus.WithError(err).Debug("Error writing state")
-		_, _ = fmt.Fprintf(w, `Error writing state`)
-		return
+	if err := injest.UpdateRuntime(s.store, s.root, dir); err != nil {
+		logrus.WithError(err).WithField("path", dir).Error("Error updating runtime")
+	}
+
+	if relPath, err := filepath.Rel(s.root, dir); err == nil {
+		s.queue(injest.QueueOptions{Directory: relPath, Push: true})
 	}
+	writeOperation(w, http.StatusOK, response)
 }
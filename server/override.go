@@ -58,49 +58,54 @@ func (s *server) ServeOverride(w http.ResponseWriter, req *http.Request) {
 
 	logrus.WithField("input", body).Debug("Processing override")
 	var info *injest.InfoType
+	var response operationResponse
 	if body.Mark {
-		info, err = injest.ReadInfo(fullPath, true)
+		changed := make(map[string]bool)
+		err = s.store.Update(fullPath, true, func(current *injest.InfoType) error {
+			info = current
+			hasTrue := false
+			hasFalse := false
+			for v := range maps.Values(info.Seen) {
+				if v {
+					hasTrue = true
+				} else {
+					hasFalse = true
+				}
+				if hasTrue && hasFalse {
+					return injest.SkipWrite
+				}
+			}
+			clear(changed)
+			for k, v := range info.Seen {
+				if v == hasTrue {
+					changed[k] = !hasTrue
+				}
+				info.SetSeen(k, !hasTrue)
+			}
+			return nil
+		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			_, _ = fmt.Fprintf(w, "Failed to read existing ID")
-			logrus.WithError(err).WithField("path", relPath).Error("Failed to read existing ID")
+			_, _ = fmt.Fprintf(w, "Failed to update seen state")
+			logrus.WithError(err).WithField("path", relPath).Error("Failed to update seen state")
 			return
 		}
-		hasTrue := false
-		hasFalse := false
-		for v := range maps.Values(info.Seen) {
-			if v {
-				hasTrue = true
-			} else {
-				hasFalse = true
-			}
-			if hasTrue && hasFalse {
-				break
+		if len(changed) > 0 {
+			response = operationResponse{Operation: newOperation(), Changed: len(changed)}
+			if err := s.recordHistory(req, response.Operation, fullPath, changed); err != nil {
+				response.Operation = "" // Can't be undone.
 			}
-		}
-		if !hasTrue || !hasFalse {
-			if !hasTrue {
-				for k := range info.Seen {
-					info.Seen[k] = true
-				}
-			} else if !hasFalse {
-				for k := range info.Seen {
-					info.Seen[k] = false
-				}
-			}
-			if err := injest.WriteInfo(fullPath, info); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				_, _ = fmt.Fprintf(w, "Failed to update seen state")
-				logrus.WithError(err).WithField("path", relPath).Error("Failed to update seen state")
-				return
+			if err := injest.UpdateRuntime(s.store, s.root, fullPath); err != nil {
+				logrus.WithError(err).WithField("path", relPath).Error("Failed to update runtime")
 			}
+			s.queue(injest.QueueOptions{Directory: relPath, Push: true})
 		}
 	}
 
 	var existingID int
 	if body.ID != 0 {
 		if info == nil {
-			info, err = injest.ReadInfo(fullPath, false)
+			info, err = s.store.ReadInfo(fullPath, false)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				_, _ = fmt.Fprintf(w, "Failed to read existing ID")
@@ -118,5 +123,5 @@ func (s *server) ServeOverride(w http.ResponseWriter, req *http.Request) {
 			Force:     body.Force,
 		})
 	}
-	w.WriteHeader(http.StatusAccepted)
+	writeOperation(w, http.StatusAccepted, response)
 }
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/mook/video-listing/injest"
+	"github.com/sirupsen/logrus"
+)
+
+// ServeReassociations lists, as JSON, the media files that were found to have
+// been renamed or moved and had their state restored, most recent first.
+func (s *server) ServeReassociations(w http.ResponseWriter, req *http.Request) {
+	var result []injest.Reassociation
+	err := s.store.Walk(func(_ string, info *injest.InfoType) error {
+		result = append(result, info.Reassociations...)
+		return nil
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to collect reassociations")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slices.SortFunc(result, func(a, b injest.Reassociation) int {
+		return b.Time.Compare(a.Time)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logrus.WithError(err).Error("Failed to write reassociations")
+	}
+}
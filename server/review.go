@@ -0,0 +1,67 @@
+package server
+
+import (
+	_ "embed"
+	"html/template"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/mook/video-listing/injest"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed review.html
+var reviewTemplateText string
+var reviewTmpl = template.Must(template.New("review.html").Parse(reviewTemplateText))
+
+type reviewEntry struct {
+	// The path relative to the media root.
+	Path            string
+	EscapedFullPath string
+	// The low confidence match, if any; if nil, the directory had no matches.
+	Review *injest.MatchReview
+	// The match score of the review, as a percentage.
+	Percent int
+}
+
+// collectReviews walks the tree starting at the given relative directory and
+// returns the media directories that need review.
+func (s *server) collectReviews(relPath string, escapedPath string) []reviewEntry {
+	info, err := s.store.ReadInfo(filepath.Join(s.root, relPath), false)
+	if err != nil {
+		logrus.WithError(err).WithField("path", relPath).Error("Failed to read info")
+		return nil
+	}
+	var results []reviewEntry
+	if info.Review != nil || (info.AniListID < 0 && len(info.Seen) > 0) {
+		entry := reviewEntry{
+			Path:            relPath,
+			EscapedFullPath: escapedPath,
+			Review:          info.Review,
+		}
+		if info.Review != nil {
+			entry.Percent = int(math.Round(info.Review.Score * 100))
+		}
+		results = append(results, entry)
+	}
+	for _, child := range slices.Sorted(maps.Keys(info.Injested)) {
+		results = append(results, s.collectReviews(
+			path.Join(relPath, child),
+			path.Join(escapedPath, url.PathEscape(child)))...)
+	}
+	return results
+}
+
+// ServeReview lists directories whose AniList match is missing or uncertain, so
+// that they can be fixed in bulk.
+func (s *server) ServeReview(w http.ResponseWriter, req *http.Request) {
+	entries := s.collectReviews(".", "")
+	if err := reviewTmpl.Execute(w, entries); err != nil {
+		logrus.WithError(err).Error("Failed to render template")
+	}
+}
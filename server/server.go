@@ -27,19 +27,60 @@ type server struct {
 	colorRegexp *regexp.Regexp
 	// A function taking a path relative to the root, which queues it to be injested.
 	queue injest.Queue
+	// The language of titles to display instead of the directory name, if any.
+	primaryLanguage string
+	// The languages of titles to display as translations.
+	languages []string
+	// Where generated artifacts are stored.
+	artifacts *injest.Artifacts
+	// Where information about directories is saved.
+	store injest.Store
+	// Where changes to the seen state of files are logged.
+	history *injest.History
 }
 
-func NewServer(root string, queue injest.Queue) http.Handler {
+// Options configures the server.
+type Options struct {
+	// The language tag of titles to display instead of directory names; if
+	// empty, directory names are always displayed.
+	PrimaryLanguage string
+	// Language tags of titles to display as translations, in order.
+	Languages []string
+	// Where generated artifacts are stored; if nil, they are hidden files next
+	// to the media.
+	Artifacts *injest.Artifacts
+	// Where information about directories is saved; this is required.
+	Store injest.Store
+	// Where changes to the seen state of files are logged; if nil, they are
+	// not logged.
+	History *injest.History
+}
+
+func NewServer(root string, queue injest.Queue, opts Options) http.Handler {
 	s := &server{
-		root:        root,
-		colorRegexp: regexp.MustCompile(`^[0-9a-f]{3}$`),
-		queue:       queue,
+		root:            root,
+		colorRegexp:     regexp.MustCompile(`^[0-9a-f]{3}$`),
+		queue:           queue,
+		primaryLanguage: opts.PrimaryLanguage,
+		languages:       opts.Languages,
+		artifacts:       opts.Artifacts,
+		store:           opts.Store,
+		history:         opts.History,
 	}
 	mux := http.NewServeMux()
 	mux.Handle("GET /l/", http.StripPrefix("/l", http.HandlerFunc(s.ServeListing)))
 	mux.Handle("GET /j/", http.StripPrefix("/j", http.HandlerFunc(s.ServeJSON)))
 	mux.Handle("POST /m/", http.StripPrefix("/m", http.HandlerFunc(s.ServeMark)))
 	mux.Handle("POST /o/", http.StripPrefix("/o", http.HandlerFunc(s.ServeOverride)))
+	mux.Handle("GET /p/", http.StripPrefix("/p", http.HandlerFunc(s.ServePreview)))
+	mux.Handle("GET /t/", http.StripPrefix("/t", http.HandlerFunc(s.ServeTrickplay)))
+	mux.Handle("GET /s/", http.StripPrefix("/s", http.HandlerFunc(s.ServeSubtitle)))
+	mux.Handle("GET /review", http.HandlerFunc(s.ServeReview))
+	mux.Handle("POST /undo/{id}", http.HandlerFunc(s.ServeUndo))
+	mux.Handle("GET /history/", http.StripPrefix("/history", http.HandlerFunc(s.ServeHistory)))
+	mux.Handle("GET /reassociations", http.HandlerFunc(s.ServeReassociations))
+	mux.Handle("GET /export", http.HandlerFunc(s.ServeExport))
+	mux.Handle("POST /import", http.HandlerFunc(s.ServeImport))
 	mux.Handle("GET /i/folder.svg", http.HandlerFunc(s.ServeFallbackImage))
 	mux.Handle("GET /i/mediaFolder.svg", http.HandlerFunc(s.ServeFallbackImage))
 	mux.Handle("GET /i/video.svg", http.HandlerFunc(s.ServeFallbackImage))
@@ -53,7 +94,12 @@ func NewServer(root string, queue injest.Queue) http.Handler {
 // corresponding file or directory on disk.  It also returns whether the given
 // path is a directory.
 func (s *server) getPath(w http.ResponseWriter, req *http.Request) (string, bool, error) {
-	relPath := path.Clean(strings.Trim(req.URL.Path, "/"))
+	return s.resolvePath(w, req.URL.Path)
+}
+
+// resolvePath is like getPath, but takes the path directly.
+func (s *server) resolvePath(w http.ResponseWriter, reqPath string) (string, bool, error) {
+	relPath := path.Clean(strings.Trim(reqPath, "/"))
 	if !fs.ValidPath(relPath) {
 		w.WriteHeader(http.StatusBadRequest)
 		_, err := fmt.Fprintf(w, `Invalid path "%s"`, relPath)
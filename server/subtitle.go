@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mook/video-listing/injest"
+	"github.com/mook/video-listing/probe"
+	"github.com/mook/video-listing/subtitle"
+	"github.com/sirupsen/logrus"
+)
+
+// subtitleTrack is a subtitle track as listed to clients.
+type subtitleTrack struct {
+	subtitle.Track
+	// The URL of the WebVTT track, relative to the listing.
+	URL string `json:"url"`
+}
+
+// ServeSubtitle serves the subtitles for a video.  The URL is the path to the
+// video followed by a slash, which lists the available tracks as JSON; each
+// track is then available as WebVTT by appending `<id>.vtt`.  Tracks are
+// converted on first request, and cached until the source changes.
+func (s *server) ServeSubtitle(w http.ResponseWriter, req *http.Request) {
+	videoPath, name := path.Split(req.URL.Path)
+	if name != "" && !strings.HasSuffix(name, ".vtt") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	fullPath, isDir, err := s.resolvePath(w, videoPath)
+	if err != nil {
+		return // Already wrote the response
+	}
+	if isDir {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	log := logrus.WithField("path", fullPath)
+	tracks, err := s.subtitleTracks(req, fullPath)
+	if err != nil {
+		log.WithError(err).Error("Failed to list subtitles")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if name == "" {
+		result := make([]subtitleTrack, 0, len(tracks))
+		for _, track := range tracks {
+			result = append(result, subtitleTrack{
+				Track: track,
+				URL:   url.PathEscape(track.ID) + ".vtt",
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.WithError(err).Error("Failed to write subtitle list")
+		}
+		return
+	}
+
+	id := strings.TrimSuffix(name, ".vtt")
+	track, ok := subtitle.Find(tracks, id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	log = log.WithField("track", id)
+	cachePath := s.artifacts.Path(injest.SubtitlePath(fullPath, id))
+	if !isFresh(cachePath, track.Source()) {
+		if cachePath, err = s.artifacts.WritePath(injest.SubtitlePath(fullPath, id)); err != nil {
+			log.WithError(err).Error("Failed to create subtitle cache directory")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := subtitle.Extract(req.Context(), track, cachePath); err != nil {
+			log.WithError(err).Error("Failed to extract subtitles")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	f, err := os.Open(cachePath)
+	if err != nil {
+		log.WithError(err).Error("Failed to open subtitles")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/vtt")
+	http.ServeContent(w, req, name, stat.ModTime(), f)
+}
+
+// subtitleTracks lists the subtitle tracks for a video, using the stored probe
+// results if available.
+func (s *server) subtitleTracks(req *http.Request, videoPath string) ([]subtitle.Track, error) {
+	var result *probe.Result
+	info, err := s.store.ReadInfo(filepath.Dir(videoPath), false)
+	if err != nil {
+		return nil, err
+	}
+	if file, ok := info.Files[filepath.Base(videoPath)]; ok && file.Probe != nil {
+		result = file.Probe
+	} else if result, err = probe.Probe(req.Context(), videoPath); err != nil {
+		return nil, err
+	}
+	return subtitle.List(videoPath, result.Subtitles)
+}
+
+// isFresh checks if the generated file exists and is newer than its source.
+func isFresh(generated, source string) bool {
+	generatedInfo, err := os.Stat(generated)
+	if err != nil {
+		return false
+	}
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return false
+	}
+	return generatedInfo.ModTime().After(sourceInfo.ModTime())
+}
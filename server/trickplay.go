@@ -0,0 +1,62 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/mook/video-listing/injest"
+	"github.com/mook/video-listing/thumbnail"
+	"github.com/sirupsen/logrus"
+)
+
+var trickplayFileRegexp = regexp.MustCompile(`^(?:index\.vtt|\d+\.jpg)$`)
+
+// ServeTrickplay serves the trickplay WebVTT thumbnail track and sprite sheets
+// for a video.  The URL is the path to the video, followed by the file name;
+// the track is always named thumbnail.TrickplayIndex, and refers to the sprite
+// sheets by relative URLs.
+func (s *server) ServeTrickplay(w http.ResponseWriter, req *http.Request) {
+	videoPath, name := path.Split(req.URL.Path)
+	if !trickplayFileRegexp.MatchString(name) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	fullPath, isDir, err := s.resolvePath(w, videoPath)
+	if err != nil {
+		return // Already wrote the response
+	}
+	if isDir {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	log := logrus.WithField("path", fullPath).WithField("name", name)
+	f, err := os.Open(filepath.Join(s.artifacts.Path(injest.TrickplayDir(fullPath)), name))
+	if err != nil {
+		log.WithError(err).Debug("Failed to open trickplay file")
+		if errors.Is(err, fs.ErrNotExist) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if name == thumbnail.TrickplayIndex {
+		w.Header().Set("Content-Type", "text/vtt")
+	} else {
+		w.Header().Set("Content-Type", "image/jpeg")
+	}
+	http.ServeContent(w, req, name, stat.ModTime(), f)
+}
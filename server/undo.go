@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io/fs"
+	"maps"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/mook/video-listing/injest"
+	"github.com/sirupsen/logrus"
+)
+
+// operationResponse is the response to requests that change the seen state of
+// files; the operation can be passed to ServeUndo to revert the changes.
+type operationResponse struct {
+	// The operation ID; empty if nothing changed.
+	Operation string `json:"operation,omitempty"`
+	// The number of files that changed.
+	Changed int `json:"changed"`
+}
+
+// newOperation returns a new, unique operation ID.
+func newOperation() string {
+	return rand.Text()
+}
+
+// writeOperation writes the response to a request that may have changed the
+// seen state of files.
+func writeOperation(w http.ResponseWriter, status int, response operationResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logrus.WithError(err).Error("Failed to write response")
+	}
+}
+
+// ServeUndo reverts the changes made by an operation, as recorded in the
+// history.  Files changed again since then are left alone.  Undoing is itself
+// an operation, which can be undone in turn.
+func (s *server) ServeUndo(w http.ResponseWriter, req *http.Request) {
+	events, err := s.history.Operation(req.PathValue("id"))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to read history")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(events) < 1 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// The state to restore each file to, by directory relative to the root.
+	restore := make(map[string]map[string]bool)
+	for _, event := range events {
+		dir, name := path.Split(event.Path)
+		dir = path.Clean(dir)
+		if !fs.ValidPath(dir) {
+			logrus.WithField("path", event.Path).Error("Invalid path in history")
+			continue
+		}
+		if restore[dir] == nil {
+			restore[dir] = make(map[string]bool)
+		}
+		restore[dir][name] = !event.Seen
+	}
+
+	response := operationResponse{Operation: newOperation()}
+	recorded := true
+	for _, relPath := range slices.Sorted(maps.Keys(restore)) {
+		directory := filepath.Join(s.root, filepath.FromSlash(relPath))
+		reverted := make(map[string]bool)
+		err := s.store.Update(directory, false, func(info *injest.InfoType) error {
+			clear(reverted)
+			for name, seen := range restore[relPath] {
+				if current, ok := info.Seen[name]; !ok || current == seen {
+					continue // Removed, or changed since.
+				}
+				info.SetSeen(name, seen)
+				reverted[name] = seen
+			}
+			if len(reverted) < 1 {
+				return injest.SkipWrite
+			}
+			return nil
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("path", relPath).Error("Failed to undo changes")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(reverted) < 1 {
+			continue
+		}
+		response.Changed += len(reverted)
+		if err := s.recordHistory(req, response.Operation, directory, reverted); err != nil {
+			recorded = false
+		}
+		if err := injest.UpdateRuntime(s.store, s.root, directory); err != nil {
+			logrus.WithError(err).WithField("path", relPath).Error("Failed to update runtime")
+		}
+		s.queue(injest.QueueOptions{Directory: filepath.FromSlash(relPath), Push: true})
+	}
+	if response.Changed < 1 || !recorded {
+		// Nothing to undo, or the history can't tell what to undo.
+		response.Operation = ""
+	}
+	writeOperation(w, http.StatusOK, response)
+}
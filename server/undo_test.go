@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mook/video-listing/injest"
+)
+
+func TestUndo(t *testing.T) {
+	root := t.TempDir()
+	show := filepath.Join(root, "show")
+	if err := os.Mkdir(show, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"1.mkv", "2.mkv"} {
+		if err := os.WriteFile(filepath.Join(show, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := injest.NewJSONStore(root, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewServer(root, func(injest.QueueOptions) {}, Options{
+		Store:   store,
+		History: injest.NewHistory(filepath.Join(t.TempDir(), injest.HistoryBaseName)),
+	})
+
+	request := func(url, body string, expectedStatus int) operationResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+		if w.Code != expectedStatus {
+			t.Fatalf("%s: expected status %d, got %d", url, expectedStatus, w.Code)
+		}
+		var response operationResponse
+		if expectedStatus < http.StatusBadRequest {
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return response
+	}
+	checkSeen := func(expected map[string]bool) {
+		t.Helper()
+		info, err := store.ReadInfo(show, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !maps.Equal(info.Seen, expected) {
+			t.Errorf("expected %v, got %v", expected, info.Seen)
+		}
+	}
+
+	toggled := request("/o/show", `{"mark": true}`, http.StatusAccepted)
+	if toggled.Operation == "" || toggled.Changed != 2 {
+		t.Errorf("unexpected toggle response %+v", toggled)
+	}
+	checkSeen(map[string]bool{"1.mkv": true, "2.mkv": true})
+
+	undone := request("/undo/"+toggled.Operation, "", http.StatusOK)
+	if undone.Operation == "" || undone.Changed != 2 {
+		t.Errorf("unexpected undo response %+v", undone)
+	}
+	checkSeen(map[string]bool{"1.mkv": false, "2.mkv": false})
+
+	// Undoing again has no effect.
+	if again := request("/undo/"+toggled.Operation, "", http.StatusOK); again.Changed != 0 {
+		t.Errorf("unexpected repeated undo response %+v", again)
+	}
+
+	// The undo can itself be undone.
+	request("/undo/"+undone.Operation, "", http.StatusOK)
+	checkSeen(map[string]bool{"1.mkv": true, "2.mkv": true})
+
+	marked := request("/m/show/1.mkv?false", "", http.StatusOK)
+	if marked.Operation == "" || marked.Changed != 1 {
+		t.Errorf("unexpected mark response %+v", marked)
+	}
+	// Marking again changes nothing.
+	if again := request("/m/show/1.mkv?false", "", http.StatusOK); again.Operation != "" {
+		t.Errorf("unexpected repeated mark response %+v", again)
+	}
+	checkSeen(map[string]bool{"1.mkv": false, "2.mkv": true})
+
+	// Files changed since are left alone.
+	request("/m/show/1.mkv?true", "", http.StatusOK)
+	if again := request("/undo/"+marked.Operation, "", http.StatusOK); again.Changed != 0 {
+		t.Errorf("unexpected undo response %+v", again)
+	}
+	checkSeen(map[string]bool{"1.mkv": true, "2.mkv": true})
+
+	request("/undo/unknown", "", http.StatusNotFound)
+}
+
+func TestUndoUnavailable(t *testing.T) {
+	testCases := []struct {
+		name    string
+		history func(t *testing.T) *injest.History
+	}{
+		{"no history", func(*testing.T) *injest.History { return nil }},
+		{"append fails", func(t *testing.T) *injest.History {
+			// The history can't be created under a regular file.
+			blocker := filepath.Join(t.TempDir(), "file")
+			if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			return injest.NewHistory(filepath.Join(blocker, injest.HistoryBaseName))
+		}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			show := filepath.Join(root, "show")
+			if err := os.Mkdir(show, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(show, "1.mkv"), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			store, err := injest.NewJSONStore(root, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := NewServer(root, func(injest.QueueOptions) {}, Options{
+				Store:   store,
+				History: testCase.history(t),
+			})
+			for _, request := range []struct {
+				url, body      string
+				expectedStatus int
+			}{
+				{"/m/show/1.mkv?true", "", http.StatusOK},
+				{"/o/show", `{"mark": true}`, http.StatusAccepted},
+			} {
+				url, body, expectedStatus := request.url, request.body, request.expectedStatus
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+				if w.Code != expectedStatus {
+					t.Fatalf("%s: expected status %d, got %d", url, expectedStatus, w.Code)
+				}
+				var response operationResponse
+				if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+					t.Fatal(err)
+				}
+				if response.Operation != "" || response.Changed != 1 {
+					t.Errorf("%s: expected a change that can't be undone, got %+v", url, response)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package subtitle finds the subtitle tracks of video files, and converts them
+// to WebVTT by spawning ffmpeg.
+package subtitle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mook/video-listing/internal/atomicfile"
+	"github.com/mook/video-listing/probe"
+)
+
+// Codecs (as named by ffprobe) of embedded subtitles that can be converted to
+// WebVTT; image based subtitles cannot be.
+var textCodecs = map[string]bool{
+	"ass":      true,
+	"ssa":      true,
+	"subrip":   true,
+	"srt":      true,
+	"webvtt":   true,
+	"mov_text": true,
+	"text":     true,
+}
+
+// Extensions of subtitle files next to videos, and their codecs.
+var sidecarExtensions = map[string]string{
+	".ass": "ass",
+	".ssa": "ssa",
+	".srt": "subrip",
+	".vtt": "webvtt",
+}
+
+// Track is a single subtitle track for a video.
+type Track struct {
+	// A stable identifier for the track.  Embedded tracks are identified by
+	// their index as `e<N>`; sidecar files by the part of their file name after
+	// the name of the video, e.g. `zh.ass` for `video.zh.ass`.
+	ID       string `json:"id"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Codec    string `json:"codec"`
+	// The file containing the track.
+	source string
+	// Whether the track is embedded in the video, rather than a sidecar file.
+	embedded bool
+	// The index of the subtitle stream in the video, for embedded tracks.
+	index int
+}
+
+// List the subtitle tracks available for a video: the text based embedded
+// subtitle streams (as previously found by probing), followed by any sidecar
+// subtitle files.
+func List(videoPath string, embedded []probe.Stream) ([]Track, error) {
+	var tracks []Track
+	for _, stream := range embedded {
+		if !textCodecs[stream.Codec] {
+			continue
+		}
+		tracks = append(tracks, Track{
+			ID:       fmt.Sprintf("e%d", stream.Index),
+			Language: stream.Language,
+			Title:    stream.Title,
+			Codec:    stream.Codec,
+			source:   videoPath,
+			embedded: true,
+			index:    stream.Index,
+		})
+	}
+
+	dir, base := filepath.Split(videoPath)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		codec, ok := sidecarExtensions[strings.ToLower(ext)]
+		if !ok || !entry.Type().IsRegular() || !strings.HasPrefix(name, stem+".") {
+			continue
+		}
+		id := strings.TrimPrefix(name, stem+".")
+		tracks = append(tracks, Track{
+			ID:       id,
+			Language: strings.TrimPrefix(strings.TrimPrefix(strings.TrimSuffix(name, ext), stem), "."),
+			Codec:    codec,
+			source:   filepath.Join(dir, name),
+		})
+	}
+	return tracks, nil
+}
+
+// Find returns the track with the given ID.
+func Find(tracks []Track, id string) (Track, bool) {
+	for _, track := range tracks {
+		if track.ID == id {
+			return track, true
+		}
+	}
+	return Track{}, false
+}
+
+// Source returns the path of the file containing the track.
+func (t Track) Source() string {
+	return t.source
+}
+
+// Extract converts a subtitle track to WebVTT, writing it to outPath.  The
+// file is replaced atomically, so a partially written track is never served.
+func Extract(ctx context.Context, track Track, outPath string) error {
+	args := []string{"-loglevel", "error", "-i", track.source}
+	if track.embedded {
+		args = append(args, "-map", fmt.Sprintf("0:s:%d", track.index))
+	}
+	args = append(args, "-f", "webvtt", "-")
+
+	var buf bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stdout = &buf
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(outPath, buf.Bytes())
+}
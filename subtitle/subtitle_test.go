@@ -0,0 +1,43 @@
+package subtitle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mook/video-listing/probe"
+)
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"ep1.mkv", "ep1.zh.ass", "ep1.srt", "ep1.txt", "ep10.en.srt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	embedded := []probe.Stream{
+		{Index: 0, Codec: "ass", Language: "jpn", Title: "Signs"},
+		{Index: 1, Codec: "hdmv_pgs_subtitle", Language: "eng"},
+		{Index: 2, Codec: "subrip", Language: "eng"},
+	}
+
+	tracks, err := List(filepath.Join(dir, "ep1.mkv"), embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Track{
+		{ID: "e0", Language: "jpn", Title: "Signs", Codec: "ass"},
+		{ID: "e2", Language: "eng", Codec: "subrip"},
+		{ID: "srt", Codec: "subrip"},
+		{ID: "zh.ass", Language: "zh", Codec: "ass"},
+	}
+	if len(tracks) != len(expected) {
+		t.Fatalf("expected %d tracks, got %+v", len(expected), tracks)
+	}
+	for i, track := range tracks {
+		if track.ID != expected[i].ID || track.Language != expected[i].Language ||
+			track.Title != expected[i].Title || track.Codec != expected[i].Codec {
+			t.Errorf("track %d: expected %+v, got %+v", i, expected[i], track)
+		}
+	}
+}
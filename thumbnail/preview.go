@@ -0,0 +1,70 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mook/video-listing/internal/atomicfile"
+)
+
+const (
+	// The length of each clip in an animated preview.
+	previewClipLength = 1500 * time.Millisecond
+	// The width of animated previews.
+	previewWidth = 320
+	// The frame rate of animated previews.
+	previewFrameRate = 10
+)
+
+// CreatePreview creates a short, muted, animated WebP preview of a video file by
+// stitching together clips from the same moments thumbnails are chosen from,
+// avoiding the given spans (see Create).
+func CreatePreview(ctx context.Context, videoPath, previewPath string, avoid []Span) error {
+	duration, err := getDuration(ctx, videoPath)
+	if err != nil {
+		return err
+	}
+	clips := timeCodes(duration, avoid)
+	if len(clips) < 1 {
+		return fmt.Errorf("video %s is too short for a preview", videoPath)
+	}
+
+	args := []string{"-loglevel", "error"}
+	var filters, labels strings.Builder
+	for i, t := range clips {
+		args = append(args,
+			"-ss", fmt.Sprintf("%f", t.Seconds()),
+			"-t", fmt.Sprintf("%f", previewClipLength.Seconds()),
+			"-i", videoPath)
+		fmt.Fprintf(&filters, "[%d:v]scale=%d:-2,fps=%d,setsar=1,setpts=PTS-STARTPTS[v%d];",
+			i, previewWidth, previewFrameRate, i)
+		fmt.Fprintf(&labels, "[v%d]", i)
+	}
+	fmt.Fprintf(&filters, "%sconcat=n=%d:v=1:a=0[out]", labels.String(), len(clips))
+	args = append(args,
+		"-filter_complex", filters.String(),
+		"-map", "[out]",
+		"-an",
+		"-c:v", "libwebp",
+		"-quality", "50",
+		"-loop", "0",
+		"-f", "webp",
+		"-")
+
+	var buf bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stdout = &buf
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	if buf.Len() < 1 {
+		return fmt.Errorf("failed to generate preview")
+	}
+	return atomicfile.WriteFile(previewPath, buf.Bytes())
+}
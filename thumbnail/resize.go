@@ -0,0 +1,91 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mook/video-listing/internal/atomicfile"
+)
+
+// Widths are the widths, in pixels, that thumbnails and covers are generated
+// at, in addition to their original size.
+var Widths = []int{160, 320, 640}
+
+// PickWidth returns the smallest entry in Widths that is at least the
+// requested width, or the largest one if none are.
+func PickWidth(requested int) int {
+	for _, width := range Widths {
+		if width >= requested {
+			return width
+		}
+	}
+	return slices.Max(Widths)
+}
+
+// SizedPath returns the path of a resized variant of an image, by inserting the
+// width before the file extension.
+func SizedPath(path string, width int) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + strconv.Itoa(width) + ext
+}
+
+// Resize scales an image down to the given width, preserving its aspect ratio,
+// by averaging the source pixels covering each output pixel.  Images that are
+// already no wider are returned as is.
+func Resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width || width < 1 {
+		return img
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := range width {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					sr, sg, sb, sa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(sr), g+uint64(sg), b+uint64(sb), a+uint64(sa)
+					n++
+				}
+			}
+			result.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return result
+}
+
+// ResizeFile writes a JPEG copy of an image file, scaled down to the given
+// width.
+func ResizeFile(srcPath, destPath string, width int) error {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, Resize(img, width), &jpeg.Options{Quality: 85}); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(destPath, buf.Bytes())
+}
@@ -0,0 +1,108 @@
+package thumbnail
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestPickWidth(t *testing.T) {
+	testCases := []struct {
+		requested int
+		expected  int
+	}{
+		{1, 160},
+		{160, 160},
+		{161, 320},
+		{640, 640},
+		{1920, 640},
+	}
+	for _, testCase := range testCases {
+		if actual := PickWidth(testCase.requested); actual != testCase.expected {
+			t.Errorf("%d: expected %d, got %d", testCase.requested, testCase.expected, actual)
+		}
+	}
+}
+
+func TestSizedPath(t *testing.T) {
+	testCases := []struct {
+		path     string
+		width    int
+		expected string
+	}{
+		{"/media/show/.01.mkv.webp", 160, "/media/show/.01.mkv.160.webp"},
+		{"/media/show/.cover.jpg", 320, "/media/show/.cover.320.jpg"},
+		{"/media/show/cover", 640, "/media/show/cover.640"},
+	}
+	for _, testCase := range testCases {
+		path := filepath.FromSlash(testCase.path)
+		if actual := SizedPath(path, testCase.width); actual != filepath.FromSlash(testCase.expected) {
+			t.Errorf("%s: expected %s, got %s", testCase.path, testCase.expected, actual)
+		}
+	}
+}
+
+// fillImage creates an image where each pixel has the color returned by fn.
+func fillImage(width, height int, fn func(x, y int) color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetRGBA(x, y, fn(x, y))
+		}
+	}
+	return img
+}
+
+func TestResize(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	halves := fillImage(8, 4, func(x, y int) color.RGBA {
+		if x < 4 {
+			return red
+		}
+		return blue
+	})
+	checker := fillImage(4, 4, func(x, y int) color.RGBA {
+		if (x+y)%2 == 0 {
+			return color.RGBA{A: 255}
+		}
+		return color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	})
+	gray := color.RGBA{R: 127, G: 127, B: 127, A: 255}
+	testCases := []struct {
+		name   string
+		img    image.Image
+		width  int
+		height int
+		// Expected colors at points in the result.
+		expected map[image.Point]color.RGBA
+	}{
+		{"halves", halves, 2, 1, map[image.Point]color.RGBA{{0, 0}: red, {1, 0}: blue}},
+		{"average", checker, 1, 1, map[image.Point]color.RGBA{{0, 0}: gray}},
+		{"not wider", halves, 8, 4, nil},
+		{"larger", halves, 16, 4, nil},
+		{"zero", halves, 0, 4, nil},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			result := Resize(testCase.img, testCase.width)
+			bounds := result.Bounds()
+			if testCase.width >= testCase.img.Bounds().Dx() || testCase.width < 1 {
+				if result != testCase.img {
+					t.Errorf("expected image to be returned as is")
+				}
+				return
+			}
+			if bounds.Dx() != testCase.width || bounds.Dy() != testCase.height {
+				t.Fatalf("expected %dx%d, got %dx%d", testCase.width, testCase.height, bounds.Dx(), bounds.Dy())
+			}
+			for point, expected := range testCase.expected {
+				if actual := color.RGBAModel.Convert(result.At(point.X, point.Y)); actual != expected {
+					t.Errorf("%v: expected %v, got %v", point, expected, actual)
+				}
+			}
+		})
+	}
+}
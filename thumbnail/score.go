@@ -0,0 +1,82 @@
+package thumbnail
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// The maximum number of pixels sampled along each axis when scoring.
+	scoreSamples = 256
+	// The number of buckets in the brightness histogram.
+	scoreBuckets = 32
+	// The mean absolute Laplacian of the sharpest images that are not noisy.
+	idealSharpness = 0.05
+)
+
+// Score rates how suitable an image is as a thumbnail, from zero (unusable) to
+// one.  Images that are nearly black, nearly white, or mostly a single flat
+// color (e.g. title cards) score poorly; bright, contrasty and sharp images
+// score well.  Beyond a certain point, sharpness is treated as noise and
+// penalized, so that noisy or grainy frames do not win.
+func Score(img image.Image) float64 {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return 0
+	}
+	step := max(1, max(bounds.Dx(), bounds.Dy())/scoreSamples)
+	width := (bounds.Dx() + step - 1) / step
+	height := (bounds.Dy() + step - 1) / step
+
+	luma := make([]float64, 0, width*height)
+	var histogram [scoreBuckets]int
+	sum := 0.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			value := float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y) / 255
+			luma = append(luma, value)
+			histogram[min(int(value*scoreBuckets), scoreBuckets-1)]++
+			sum += value
+		}
+	}
+
+	mean := sum / float64(len(luma))
+	variance := 0.0
+	for _, value := range luma {
+		variance += (value - mean) * (value - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(luma)))
+
+	// Reject black, white, and flat frames outright.
+	if mean < 0.08 || mean > 0.95 || stddev < 0.04 {
+		return 0
+	}
+
+	// Sharpness is the mean absolute Laplacian.
+	laplacian := 0.0
+	if width > 2 && height > 2 {
+		for y := 1; y < height-1; y++ {
+			for x := 1; x < width-1; x++ {
+				i := y*width + x
+				laplacian += math.Abs(4*luma[i] - luma[i-1] - luma[i+1] - luma[i-width] - luma[i+width])
+			}
+		}
+		laplacian /= float64((width - 2) * (height - 2))
+	}
+
+	// The fraction of the image that is the most common brightness.
+	flat := 0
+	for _, count := range histogram {
+		flat = max(flat, count)
+	}
+
+	brightnessScore := max(0, 1-math.Abs(mean-0.5)*2)
+	contrastScore := min(1, stddev/0.25)
+	sharpnessScore := laplacian / idealSharpness
+	if sharpnessScore > 1 {
+		sharpnessScore = 1 / sharpnessScore
+	}
+	flatScore := 1 - float64(flat)/float64(len(luma))
+	return brightnessScore * contrastScore * sharpnessScore * flatScore
+}
@@ -0,0 +1,79 @@
+package thumbnail
+
+import (
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"testing"
+)
+
+// generate an image by calling the function for each pixel.
+func generate(width, height int, fn func(x, y int) uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetGray(x, y, color.Gray{Y: fn(x, y)})
+		}
+	}
+	return img
+}
+
+func TestScore(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+	// A scene with large shapes of varying brightness, and some fine detail.
+	scene := generate(320, 180, func(x, y int) uint8 {
+		value := 40 + (x/40)*20 + (y/30)*10
+		if (x/3+y/3)%7 == 0 {
+			value += 12
+		}
+		return uint8(value)
+	})
+	// Light text on a black background.
+	titleCard := generate(320, 180, func(x, y int) uint8 {
+		if y > 80 && y < 100 && x > 60 && x < 260 && (x/4)%2 == 0 {
+			return 240
+		}
+		return 5
+	})
+	// Pure noise.
+	noise := generate(320, 180, func(x, y int) uint8 {
+		return uint8(random.IntN(256))
+	})
+
+	testCases := []struct {
+		name string
+		img  image.Image
+		zero bool
+	}{
+		{"empty", image.NewGray(image.Rect(0, 0, 0, 0)), true},
+		{"black", generate(320, 180, func(x, y int) uint8 { return 2 }), true},
+		{"white", generate(320, 180, func(x, y int) uint8 { return 253 }), true},
+		{"flat", generate(320, 180, func(x, y int) uint8 { return 128 }), true},
+		{"scene", scene, false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			score := Score(testCase.img)
+			if score < 0 || score > 1 {
+				t.Errorf("score %f out of range", score)
+			}
+			if testCase.zero != (score == 0) {
+				t.Errorf("unexpected score %f", score)
+			}
+		})
+	}
+
+	t.Run("title card", func(t *testing.T) {
+		t.Parallel()
+		if Score(titleCard) >= Score(scene) {
+			t.Errorf("title card (%f) should score below scene (%f)", Score(titleCard), Score(scene))
+		}
+	})
+	t.Run("noise", func(t *testing.T) {
+		t.Parallel()
+		if Score(noise) >= Score(scene) {
+			t.Errorf("noise (%f) should score below scene (%f)", Score(noise), Score(scene))
+		}
+	})
+}
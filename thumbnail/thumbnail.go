@@ -3,57 +3,176 @@ package thumbnail
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"fmt"
+	"image"
+	"image/png"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mook/video-listing/internal/atomicfile"
 	"github.com/sirupsen/logrus"
 )
 
-// Given the path if a video file, create a thumbnail at the given path.
-func Create(ctx context.Context, videoPath, thumbnailPath string) error {
+const (
+	// The number of candidate frames to consider.
+	candidateCount = 5
+	// Videos longer than this are likely to be TV shows or similar, with an
+	// opening and an ending.
+	longVideo = 10 * time.Minute
+	// The length of the opening and ending to guess if they aren't known.
+	defaultMargin = 2 * time.Minute
+)
+
+// Span is a section of a video, such as an opening or ending sequence.
+type Span struct {
+	Start, End time.Duration
+}
+
+// Given the path if a video file, create a thumbnail at the given path.  The
+// candidate frames are scored (see Score), and the time of the chosen frame is
+// returned so that it can be reproduced with CreateAt.  Candidates are not
+// taken from the spans to avoid; if none are given, the opening and ending are
+// guessed instead.
+func Create(ctx context.Context, videoPath, thumbnailPath string, avoid []Span) (time.Duration, error) {
 	duration, err := getDuration(ctx, videoPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var best time.Duration
+	bestScore := -1.0
+	for _, t := range timeCodes(duration, avoid) {
+		log := logrus.WithField("path", videoPath).WithField("time", t)
+		img, err := getFrame(ctx, videoPath, t, slices.Max(Widths))
+		if err != nil {
+			log.WithError(err).Error("Failed to generate thumbnail")
+			continue
+		}
+		score := Score(img)
+		log.WithField("score", score).Debug("Scored thumbnail candidate")
+		if score > bestScore {
+			best, bestScore = t, score
+		}
+	}
+
+	if bestScore < 0 {
+		return 0, fmt.Errorf("failed to generate thumbnail")
+	}
+
+	return best, CreateAt(ctx, videoPath, thumbnailPath, best)
+}
+
+// CreateAt creates a WebP thumbnail from the frame at the given time.  Smaller
+// variants are also created for each of Widths (see SizedPath), by resizing
+// the same frame.
+func CreateAt(ctx context.Context, videoPath, thumbnailPath string, t time.Duration) error {
+	frame, err := getFrame(ctx, videoPath, t, 0)
 	if err != nil {
 		return err
 	}
-	var timeCodes []time.Duration
-	if duration > 10*time.Minute {
+	for _, width := range append([]int{0}, Widths...) {
+		data, err := encodeWebP(ctx, Resize(frame, width))
+		if err != nil {
+			return err
+		}
+		outPath := thumbnailPath
+		if width > 0 {
+			outPath = SizedPath(thumbnailPath, width)
+		}
+		if err := atomicfile.WriteFile(outPath, data.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeCodes returns the times within a video of the given duration that are
+// likely to be representative of the video, outside of the spans to avoid.
+func timeCodes(duration time.Duration, avoid []Span) []time.Duration {
+	var result []time.Duration
+	if len(avoid) > 0 {
+		// Spread the candidates evenly over the remaining parts of the video.
+		allowed := allowedSpans(duration, withDefaultMargins(duration, avoid))
+		var total time.Duration
+		for _, span := range allowed {
+			total += span.End - span.Start
+		}
+		if total <= 0 {
+			return timeCodes(duration, nil)
+		}
+		for n := range candidateCount {
+			offset := total * time.Duration(2*n+1) / (2 * candidateCount)
+			for _, span := range allowed {
+				if offset < span.End-span.Start {
+					result = append(result, span.Start+offset)
+					break
+				}
+				offset -= span.End - span.Start
+			}
+		}
+	} else if duration > longVideo {
 		// If a video is more than ten minutes, there is a good chance that this is
 		// a TV show or similar; avoid the first and last couple minutes for opening
 		// and ending.
-		offset := (duration - 4*time.Minute) / 5
-		for t := 2 * time.Minute; t < duration-2*time.Minute; t += offset {
-			timeCodes = append(timeCodes, t)
+		offset := (duration - 2*defaultMargin) / candidateCount
+		for t := defaultMargin; t < duration-defaultMargin; t += offset {
+			result = append(result, t)
 		}
-	} else {
-		for t := time.Duration(0); t < duration; t += duration / 5 {
-			timeCodes = append(timeCodes, t)
+	} else if duration > 0 {
+		for t := time.Duration(0); t < duration; t += duration / candidateCount {
+			result = append(result, t)
 		}
 	}
+	return result
+}
 
-	best := &bytes.Buffer{}
-	for _, t := range timeCodes {
-		candidate, err := getFrame(ctx, videoPath, float64(t)/float64(time.Second))
-		if err != nil {
-			logrus.WithError(err).WithField("path", videoPath).Error("Failed to generate thumbnail")
-		} else if candidate.Len() > best.Len() {
-			best = candidate
+// withDefaultMargins adds the guessed opening or ending of a long video to the
+// spans to avoid, when only the other one is known.  Spans starting in the
+// first half of the video are taken to be the opening, and others the ending.
+func withDefaultMargins(duration time.Duration, avoid []Span) []Span {
+	if duration <= longVideo {
+		return avoid
+	}
+	hasOpening, hasEnding := false, false
+	for _, span := range avoid {
+		if span.Start < duration/2 {
+			hasOpening = true
+		} else {
+			hasEnding = true
 		}
 	}
-
-	if best.Len() < 1 {
-		return fmt.Errorf("failed to generate thumbnail")
+	if !hasOpening {
+		avoid = append(slices.Clone(avoid), Span{Start: 0, End: defaultMargin})
+	}
+	if !hasEnding {
+		avoid = append(slices.Clone(avoid), Span{Start: duration - defaultMargin, End: duration})
 	}
+	return avoid
+}
 
-	if err := os.WriteFile(thumbnailPath, best.Bytes(), 0o644); err != nil {
-		_ = os.Remove(thumbnailPath)
-		return err
+// allowedSpans returns the parts of a video of the given duration that are not
+// in any of the spans to avoid.
+func allowedSpans(duration time.Duration, avoid []Span) []Span {
+	avoid = slices.Clone(avoid)
+	slices.SortFunc(avoid, func(a, b Span) int { return cmp.Compare(a.Start, b.Start) })
+	var result []Span
+	var cursor time.Duration
+	for _, span := range avoid {
+		if end := min(span.Start, duration); end > cursor {
+			result = append(result, Span{Start: cursor, End: end})
+		}
+		cursor = max(cursor, span.End)
 	}
-	return nil
+	if cursor < duration {
+		result = append(result, Span{Start: cursor, End: duration})
+	}
+	return result
 }
 
 // Get the duration of a video file.
@@ -75,21 +194,56 @@ func getDuration(ctx context.Context, videoPath string) (time.Duration, error) {
 	return time.Duration(result * float64(time.Second)), nil
 }
 
-func getFrame(ctx context.Context, videoPath string, timeCode float64) (*bytes.Buffer, error) {
+// getFrame extracts a representative frame from the ten seconds following the
+// given time.  If width is not zero, frames wider than it are scaled down.
+func getFrame(ctx context.Context, videoPath string, timeCode time.Duration, width int) (image.Image, error) {
 	var buf bytes.Buffer
+	filter := "select=eq(pict_type\\,I),thumbnail"
+	if width > 0 {
+		filter += fmt.Sprintf(",scale=w='min(%d\\,iw)':h=-2", width)
+	}
 	cmd := exec.CommandContext(ctx, "ffmpeg",
 		"-loglevel", "error",
-		"-ss", fmt.Sprintf("%f", timeCode),
+		"-ss", fmt.Sprintf("%f", timeCode.Seconds()),
 		"-t", "10",
 		"-i", videoPath,
-		"-filter:v", "select=eq(pict_type\\,I),thumbnail",
+		"-filter:v", filter,
 		"-frames:v", "1",
+		"-c:v", "png",
+		"-f", "image2pipe",
+		"-")
+	cmd.Stdout = &buf
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	if buf.Len() < 1 {
+		return nil, fmt.Errorf("failed to extract frame at %s", timeCode)
+	}
+	return png.Decode(&buf)
+}
+
+// encodeWebP encodes an image as WebP, which the standard library can't do;
+// this is much cheaper than extracting the frame again.
+func encodeWebP(ctx context.Context, img image.Image) (*bytes.Buffer, error) {
+	var input, buf bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.NoCompression}).Encode(&input, img); err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-loglevel", "error",
+		"-f", "png_pipe",
+		"-i", "-",
 		"-f", "webp",
 		"-")
+	cmd.Stdin = &input
 	cmd.Stdout = &buf
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
 		return nil, err
 	}
+	if buf.Len() < 1 {
+		return nil, fmt.Errorf("failed to encode thumbnail")
+	}
 	return &buf, nil
 }
@@ -0,0 +1,93 @@
+package thumbnail
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTimeCodes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		duration time.Duration
+		avoid    []Span
+		expected []time.Duration
+	}{
+		{
+			name:     "short",
+			duration: 5 * time.Minute,
+			expected: []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute},
+		},
+		{
+			name:     "episode",
+			duration: 24 * time.Minute,
+			expected: []time.Duration{2 * time.Minute, 6 * time.Minute, 10 * time.Minute, 14 * time.Minute, 18 * time.Minute},
+		},
+		{
+			name:     "avoid",
+			duration: 24 * time.Minute,
+			avoid: []Span{
+				{Start: 20 * time.Minute, End: 24 * time.Minute},
+				{Start: 0, End: 4 * time.Minute},
+			},
+			expected: []time.Duration{
+				5*time.Minute + 36*time.Second,
+				8*time.Minute + 48*time.Second,
+				12 * time.Minute,
+				15*time.Minute + 12*time.Second,
+				18*time.Minute + 24*time.Second,
+			},
+		},
+		{
+			name:     "opening only",
+			duration: 24 * time.Minute,
+			avoid:    []Span{{Start: 0, End: 4 * time.Minute}},
+			expected: []time.Duration{
+				5*time.Minute + 48*time.Second,
+				9*time.Minute + 24*time.Second,
+				13 * time.Minute,
+				16*time.Minute + 36*time.Second,
+				20*time.Minute + 12*time.Second,
+			},
+		},
+		{
+			name:     "ending only",
+			duration: 24 * time.Minute,
+			avoid:    []Span{{Start: 20 * time.Minute, End: 24 * time.Minute}},
+			expected: []time.Duration{
+				3*time.Minute + 48*time.Second,
+				7*time.Minute + 24*time.Second,
+				11 * time.Minute,
+				14*time.Minute + 36*time.Second,
+				18*time.Minute + 12*time.Second,
+			},
+		},
+		{
+			name:     "avoid middle",
+			duration: 10 * time.Minute,
+			avoid:    []Span{{Start: time.Minute, End: 6 * time.Minute}},
+			expected: []time.Duration{
+				30 * time.Second,
+				6*time.Minute + 30*time.Second,
+				7*time.Minute + 30*time.Second,
+				8*time.Minute + 30*time.Second,
+				9*time.Minute + 30*time.Second,
+			},
+		},
+		{
+			name:     "avoid everything",
+			duration: 5 * time.Minute,
+			avoid:    []Span{{Start: 0, End: 5 * time.Minute}},
+			expected: []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			actual := timeCodes(testCase.duration, testCase.avoid)
+			if !slices.Equal(actual, testCase.expected) {
+				t.Errorf("expected %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
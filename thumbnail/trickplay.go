@@ -0,0 +1,134 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mook/video-listing/internal/atomicfile"
+)
+
+const (
+	// The number of columns and rows of frames in each trickplay sprite sheet.
+	trickplayColumns = 10
+	trickplayRows    = 10
+	// The width of each frame in trickplay sprite sheets.
+	trickplayWidth = 160
+	// The name of the WebVTT thumbnails track in the trickplay directory.
+	TrickplayIndex = "index.vtt"
+)
+
+// TrickplaySheet returns the file name of the nth trickplay sprite sheet.
+func TrickplaySheet(n int) string {
+	return fmt.Sprintf("%d.jpg", n)
+}
+
+// CreateTrickplay samples frames from a video at the given interval, tiling
+// them into sprite sheets in the output directory along with a WebVTT track
+// (TrickplayIndex) describing where each frame is.  Sheets that already exist
+// are kept, so an interrupted run will resume where it left off; the track is
+// written last, once all sheets are available.
+func CreateTrickplay(ctx context.Context, videoPath, outDir string, interval time.Duration) error {
+	duration, err := getDuration(ctx, videoPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return err
+	}
+
+	perSheet := trickplayColumns * trickplayRows
+	frames := int((duration + interval - 1) / interval)
+	sheets := (frames + perSheet - 1) / perSheet
+	for n := range sheets {
+		sheetPath := filepath.Join(outDir, TrickplaySheet(n))
+		if _, err := os.Stat(sheetPath); err == nil {
+			continue // Already generated on a previous run.
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		start := time.Duration(n*perSheet) * interval
+		sheet, err := getSheet(ctx, videoPath, start, time.Duration(perSheet)*interval, interval)
+		if err != nil {
+			return err
+		}
+		if err := atomicfile.WriteFile(sheetPath, sheet.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	// All sprite sheets have the same layout; figure out the size of each frame.
+	f, err := os.Open(filepath.Join(outDir, TrickplaySheet(0)))
+	if err != nil {
+		return err
+	}
+	config, _, err := image.DecodeConfig(f)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	width, height := config.Width/trickplayColumns, config.Height/trickplayRows
+	track := trickplayTrack(duration, interval, width, height)
+	return atomicfile.WriteFile(filepath.Join(outDir, TrickplayIndex), []byte(track))
+}
+
+// trickplayTrack returns the WebVTT track describing where the frame for each
+// interval of a video is in the sprite sheets, given the size of each frame.
+func trickplayTrack(duration, interval time.Duration, width, height int) string {
+	perSheet := trickplayColumns * trickplayRows
+	frames := int((duration + interval - 1) / interval)
+	var buf strings.Builder
+	buf.WriteString("WEBVTT\n")
+	for frame := range frames {
+		start := time.Duration(frame) * interval
+		end := min(start+interval, duration)
+		index := frame % perSheet
+		fmt.Fprintf(&buf, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			formatTimestamp(start), formatTimestamp(end),
+			TrickplaySheet(frame/perSheet),
+			(index%trickplayColumns)*width, (index/trickplayColumns)*height,
+			width, height)
+	}
+	return buf.String()
+}
+
+// getSheet generates a single sprite sheet covering the given span of a video.
+func getSheet(ctx context.Context, videoPath string, start, span, interval time.Duration) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-loglevel", "error",
+		"-ss", fmt.Sprintf("%f", start.Seconds()),
+		"-t", fmt.Sprintf("%f", span.Seconds()),
+		"-i", videoPath,
+		"-filter:v", fmt.Sprintf("fps=1/%f,scale=%d:-2,tile=%dx%d",
+			interval.Seconds(), trickplayWidth, trickplayColumns, trickplayRows),
+		"-frames:v", "1",
+		"-q:v", "5",
+		"-f", "image2pipe",
+		"-c:v", "mjpeg",
+		"-")
+	cmd.Stdout = &buf
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	if buf.Len() < 1 {
+		return nil, fmt.Errorf("failed to generate sprite sheet at %s", start)
+	}
+	return &buf, nil
+}
+
+// formatTimestamp formats a duration as a WebVTT timestamp.
+func formatTimestamp(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d:%02d.%03d",
+		int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
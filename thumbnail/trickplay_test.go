@@ -0,0 +1,56 @@
+package thumbnail
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	testCases := []struct {
+		input    time.Duration
+		expected string
+	}{
+		{0, "00:00:00.000"},
+		{1500 * time.Millisecond, "00:00:01.500"},
+		{23*time.Minute + 45*time.Second, "00:23:45.000"},
+		{2*time.Hour + 3*time.Minute + 4*time.Second + 5*time.Millisecond, "02:03:04.005"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.expected, func(t *testing.T) {
+			t.Parallel()
+			if actual := formatTimestamp(testCase.input); actual != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTrickplayTrack(t *testing.T) {
+	perSheet := trickplayColumns * trickplayRows
+	interval := 10 * time.Second
+	// One more frame than fits in a sheet, with the last frame cut short.
+	duration := time.Duration(perSheet)*interval + 5*time.Second
+	track := trickplayTrack(duration, interval, 160, 90)
+	cues := strings.Split(strings.TrimSpace(track), "\n\n")
+	if cues[0] != "WEBVTT" {
+		t.Fatalf("expected WebVTT header, got %q", cues[0])
+	}
+	cues = cues[1:]
+	if len(cues) != perSheet+1 {
+		t.Fatalf("expected %d cues, got %d", perSheet+1, len(cues))
+	}
+	expected := map[int]string{
+		0:                    "00:00:00.000 --> 00:00:10.000\n0.jpg#xywh=0,0,160,90",
+		1:                    "00:00:10.000 --> 00:00:20.000\n0.jpg#xywh=160,0,160,90",
+		trickplayColumns:     "00:01:40.000 --> 00:01:50.000\n0.jpg#xywh=0,90,160,90",
+		trickplayColumns + 1: "00:01:50.000 --> 00:02:00.000\n0.jpg#xywh=160,90,160,90",
+		perSheet - 1:         "00:16:30.000 --> 00:16:40.000\n0.jpg#xywh=1440,810,160,90",
+		perSheet:             "00:16:40.000 --> 00:16:45.000\n1.jpg#xywh=0,0,160,90",
+	}
+	for index, cue := range expected {
+		if cues[index] != cue {
+			t.Errorf("cue %d: expected %q, got %q", index, cue, cues[index])
+		}
+	}
+}